@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ft-mt/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ограничения размера страницы listUsers
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 200
+)
+
+// validRoles роли из CHECK таблицы users
+var validRoles = map[string]bool{"admin": true, "trader": true, "user": true, "viewer": true}
+
+// Действия в user_audit
+const (
+	auditCreated     = "created"
+	auditRoleChanged = "role_changed"
+	auditActivated   = "activated"
+	auditDeactivated = "deactivated"
+	auditDeleted     = "deleted"
+
+	// auditInviteCreated выдан код приглашения: user_id - выдавший admin
+	auditInviteCreated = "invite_created"
+)
+
+// Ошибки изменения пользователей
+var (
+	errUserNotFound = errors.New("user not found")
+	errLastAdmin    = errors.New("cannot remove the last active admin")
+)
+
+// ChangeRoleRequest запрос на смену роли
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ChangeStatusRequest запрос на активацию или деактивацию
+type ChangeStatusRequest struct {
+	IsActive *bool `json:"is_active" binding:"required"`
+}
+
+// UserFilter параметры listUsers
+type UserFilter struct {
+	Role   string // Пусто - все роли
+	Active *bool  // nil - все
+	Email  string // Подстрока email без учёта регистра
+	Limit  int
+	Offset int
+}
+
+// UserPage страница listUsers
+type UserPage struct {
+	Users  []User `json:"users"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// listUsers список пользователей (только admin): ?role=&status=active|inactive&q=&limit=&offset=
+func listUsers(c *gin.Context) {
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+
+	where, args := filter.where()
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users"+where, args...).Scan(&total); err != nil {
+		logging.FromContext(ctx).Error("❌ Ошибка подсчёта пользователей", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, email, role, is_active, created_at, last_login
+		FROM users%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2), append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		logging.FromContext(ctx).Error("❌ Ошибка выборки пользователей", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	page := UserPage{Users: []User{}, Total: total, Limit: filter.Limit, Offset: filter.Offset}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.IsActive, &user.CreatedAt, &user.LastLogin); err != nil {
+			logging.FromContext(ctx).Error("❌ Ошибка чтения пользователя", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		logging.FromContext(ctx).Error("❌ Ошибка выборки пользователей", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// parseUserFilter разбирает и проверяет параметры listUsers
+func parseUserFilter(c *gin.Context) (UserFilter, error) {
+	filter := UserFilter{Role: c.Query("role"), Email: strings.TrimSpace(c.Query("q")), Limit: defaultUsersLimit}
+
+	if filter.Role != "" && !validRoles[filter.Role] {
+		return filter, fmt.Errorf("role must be one of admin, trader, user, viewer")
+	}
+	switch status := c.Query("status"); status {
+	case "":
+	case "active", "inactive":
+		active := status == "active"
+		filter.Active = &active
+	default:
+		return filter, fmt.Errorf("status must be active or inactive")
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxUsersLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxUsersLimit)
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("offset must be a non-negative integer")
+		}
+		filter.Offset = offset
+	}
+	return filter, nil
+}
+
+// where условие WHERE фильтра с параметрами $1..$n (пустая строка без фильтров)
+func (f UserFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.Role != "" {
+		args = append(args, f.Role)
+		conds = append(conds, fmt.Sprintf("role = $%d", len(args)))
+	}
+	if f.Active != nil {
+		args = append(args, *f.Active)
+		conds = append(conds, fmt.Sprintf("is_active = $%d", len(args)))
+	}
+	if f.Email != "" {
+		// % и _ в запросе ищутся буквально
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Email)
+		args = append(args, "%"+escaped+"%")
+		conds = append(conds, fmt.Sprintf("email ILIKE $%d", len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// changeUserRole изменить роль пользователя (только admin)
+func changeUserRole(c *gin.Context) {
+	targetID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	var req ChangeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of admin, trader, user, viewer"})
+		return
+	}
+
+	user, err := modifyUser(c.Request.Context(), c.GetInt("user_id"), targetID, func(user *User) (string, error) {
+		if user.Role == req.Role {
+			return "", nil
+		}
+		user.Role = req.Role
+		return auditRoleChanged, nil
+	})
+	respondUserChange(c, "🛡️ Роль пользователя изменена", user, err)
+}
+
+// changeUserStatus активировать или деактивировать пользователя (только admin).
+// Деактивированный пользователь не может войти, его токены отзываются.
+func changeUserStatus(c *gin.Context) {
+	targetID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	var req ChangeStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := modifyUser(c.Request.Context(), c.GetInt("user_id"), targetID, func(user *User) (string, error) {
+		if user.IsActive == *req.IsActive {
+			return "", nil
+		}
+		user.IsActive = *req.IsActive
+		if user.IsActive {
+			return auditActivated, nil
+		}
+		return auditDeactivated, nil
+	})
+	respondUserChange(c, "🛡️ Статус пользователя изменён", user, err)
+}
+
+// deleteUser удалить пользователя (только admin). Его токены удаляются каскадно.
+func deleteUser(c *gin.Context) {
+	targetID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	user, err := modifyUser(c.Request.Context(), c.GetInt("user_id"), targetID, func(user *User) (string, error) {
+		return auditDeleted, nil
+	})
+	if err == nil {
+		logging.FromContext(c.Request.Context()).Info("🗑️ Пользователь удалён", "admin_id", c.GetInt("user_id"), "user_id", user.ID, "email", user.Email)
+		c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+		return
+	}
+	respondUserChange(c, "", user, err)
+}
+
+// userIDParam разбирает :id; при ошибке отвечает 400
+func userIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondUserChange отвечает на изменение пользователя: 200 с пользователем или ошибка
+func respondUserChange(c *gin.Context, message string, user User, err error) {
+	logger := logging.FromContext(c.Request.Context())
+	switch {
+	case errors.Is(err, errUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last active admin"})
+	case err != nil:
+		logger.Error("❌ Ошибка изменения пользователя", "user_id", user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	default:
+		logger.Info(message, "admin_id", c.GetInt("user_id"), "user_id", user.ID, "role", user.Role, "is_active", user.IsActive)
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// modifyUser применяет изменение change к пользователю targetID в транзакции
+// и пишет его в user_audit. change меняет копию пользователя и возвращает
+// действие аудита ("" - ничего не изменилось). Если после изменения не
+// останется ни одного активного admin, возвращается errLastAdmin.
+func modifyUser(ctx context.Context, actorID, targetID int, change func(*User) (string, error)) (User, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	// Блокируем всех активных admin: два admin не смогут одновременно понизить друг друга
+	admins, err := lockActiveAdmins(ctx, tx)
+	if err != nil {
+		return User{}, err
+	}
+
+	var before User
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, email, role, is_active, created_at, last_login
+		FROM users WHERE id = $1
+		FOR UPDATE
+	`, targetID).Scan(&before.ID, &before.Email, &before.Role, &before.IsActive, &before.CreatedAt, &before.LastLogin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	after := before
+	action, err := change(&after)
+	if err != nil || action == "" {
+		return before, err
+	}
+
+	wasAdmin := before.Role == "admin" && before.IsActive
+	staysAdmin := action != auditDeleted && after.Role == "admin" && after.IsActive
+	if wasAdmin && !staysAdmin && admins <= 1 {
+		return before, errLastAdmin
+	}
+
+	if action == auditDeleted {
+		// Аудит до удаления: admin может удалить и себя (changed_by станет NULL)
+		err = writeUserAudit(ctx, tx, actorID, targetID, action, &before, nil)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "DELETE FROM users WHERE id = $1", targetID)
+		}
+	} else {
+		// Версия токенов растёт: старые access токены с прежней ролью отклоняются,
+		// клиент получает новую роль через /auth/refresh
+		_, err = tx.ExecContext(ctx, `
+			UPDATE users SET role = $1, is_active = $2, token_version = token_version + 1
+			WHERE id = $3
+		`, after.Role, after.IsActive, targetID)
+		if err == nil && !after.IsActive {
+			err = revokeUserTokens(ctx, tx, targetID)
+		}
+		if err == nil {
+			err = writeUserAudit(ctx, tx, actorID, targetID, action, &before, &after)
+		}
+	}
+	if err != nil {
+		return before, err
+	}
+	return after, tx.Commit()
+}
+
+// lockActiveAdmins блокирует строки активных admin и возвращает их число
+func lockActiveAdmins(ctx context.Context, tx *sql.Tx) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM users WHERE role = 'admin' AND is_active FOR UPDATE")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	return count, rows.Err()
+}
+
+// writeUserAudit записывает действие admin actorID над пользователем targetID
+func writeUserAudit(ctx context.Context, q execer, actorID, targetID int, action string, before, after *User) error {
+	oldData, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	newData, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO user_audit (user_id, action, changed_by, old_data, new_data)
+		VALUES ($1, $2, $3, $4, $5)
+	`, targetID, action, actorID, oldData, newData)
+	return err
+}
+
+// auditJSON снимок пользователя для аудита (без хеша пароля); nil -> NULL
+func auditJSON(user *User) (*string, error) {
+	if user == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return &s, nil
+}
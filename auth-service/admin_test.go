@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// TestParseUserFilter проверяет разбор параметров listUsers
+func TestParseUserFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	parse := func(query string) (UserFilter, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/auth/admin/users?"+query, nil)
+		return parseUserFilter(c)
+	}
+
+	filter, err := parse("")
+	if err != nil || filter.Limit != defaultUsersLimit || filter.Offset != 0 || filter.Active != nil {
+		t.Errorf("Unexpected default filter %+v %v", filter, err)
+	}
+
+	filter, err = parse("role=trader&status=inactive&q=%20Quotopia%20&limit=10&offset=20")
+	if err != nil || filter.Role != "trader" || filter.Active == nil || *filter.Active ||
+		filter.Email != "Quotopia" || filter.Limit != 10 || filter.Offset != 20 {
+		t.Errorf("Unexpected filter %+v %v", filter, err)
+	}
+
+	for _, query := range []string{"role=root", "status=banned", "limit=0", "limit=1000", "offset=-1", "limit=abc"} {
+		if _, err := parse(query); err == nil {
+			t.Errorf("Query %q should fail", query)
+		}
+	}
+}
+
+// TestUserFilterWhere проверяет SQL условие фильтра
+func TestUserFilterWhere(t *testing.T) {
+	if where, args := (UserFilter{}).where(); where != "" || args != nil {
+		t.Errorf("Empty filter should have no WHERE, got %q %v", where, args)
+	}
+
+	active := true
+	where, args := UserFilter{Role: "admin", Active: &active, Email: "50%_off"}.where()
+	if where != " WHERE role = $1 AND is_active = $2 AND email ILIKE $3" {
+		t.Errorf("Unexpected WHERE %q", where)
+	}
+	if !reflect.DeepEqual(args, []any{"admin", true, `%50\%\_off%`}) {
+		t.Errorf("Unexpected args %v", args)
+	}
+}
+
+// TestAdminRequestValidation проверяет, что некорректные запросы отклоняются до БД
+func TestAdminRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/auth/admin/users", listUsers)
+	r.PUT("/auth/admin/users/:id/role", changeUserRole)
+	r.PUT("/auth/admin/users/:id/status", changeUserStatus)
+	r.DELETE("/auth/admin/users/:id", deleteUser)
+
+	cases := []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, "/auth/admin/users?status=banned", ""},
+		{http.MethodPut, "/auth/admin/users/abc/role", `{"role":"trader"}`},
+		{http.MethodPut, "/auth/admin/users/2/role", `{"role":"root"}`},
+		{http.MethodPut, "/auth/admin/users/2/role", `{}`},
+		{http.MethodPut, "/auth/admin/users/2/status", `{}`},
+		{http.MethodDelete, "/auth/admin/users/0", ""},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected 400, got %d", tc.method, tc.path, tc.body, w.Code)
+		}
+	}
+}
+
+// jsonWith аргумент запроса - JSON снимок, содержащий подстроку; nilJSON - NULL
+type jsonWith string
+
+// Match реализует sqlmock.Argument
+func (want jsonWith) Match(v driver.Value) bool {
+	if want == "" {
+		return v == nil
+	}
+	s, ok := v.(string)
+	return ok && strings.Contains(s, string(want))
+}
+
+const nilJSON = jsonWith("")
+
+// adminRouter маршруты изменения пользователей от имени admin с id 1
+func adminRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 1) })
+	r.PUT("/auth/admin/users/:id/role", changeUserRole)
+	r.PUT("/auth/admin/users/:id/status", changeUserStatus)
+	r.DELETE("/auth/admin/users/:id", deleteUser)
+	return r
+}
+
+// expectModifyUser ожидает начало modifyUser: блокировку admins активных admin
+// и строки пользователя
+func expectModifyUser(mock sqlmock.Sqlmock, admins int, target User) {
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"id"})
+	for i := 0; i < admins; i++ {
+		rows.AddRow(i + 1)
+	}
+	mock.ExpectQuery(quoteSQL("SELECT id FROM users WHERE role = 'admin' AND is_active FOR UPDATE")).WillReturnRows(rows)
+	mock.ExpectQuery(quoteSQL("FROM users WHERE id = $1")).WithArgs(target.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "is_active", "created_at", "last_login"}).
+			AddRow(target.ID, target.Email, target.Role, target.IsActive, time.Now(), nil))
+}
+
+func adminRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+// TestLastAdminGuard проверяет, что последнего активного admin нельзя
+// понизить, деактивировать или удалить, а ничего не записывается
+func TestLastAdminGuard(t *testing.T) {
+	admin := User{ID: 1, Email: "admin@quotopia.com", Role: "admin", IsActive: true}
+	cases := []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/auth/admin/users/1/role", `{"role":"trader"}`},
+		{http.MethodPut, "/auth/admin/users/1/status", `{"is_active":false}`},
+		{http.MethodDelete, "/auth/admin/users/1", ""},
+	}
+	for _, tc := range cases {
+		mock := mockDB(t)
+		expectModifyUser(mock, 1, admin)
+		mock.ExpectRollback()
+
+		if w := adminRequest(adminRouter(), tc.method, tc.path, tc.body); w.Code != http.StatusConflict {
+			t.Errorf("%s %s: expected 409, got %d", tc.method, tc.path, w.Code)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s %s: %v", tc.method, tc.path, err)
+		}
+	}
+
+	// Второй активный admin есть - понижение проходит
+	mock := mockDB(t)
+	expectModifyUser(mock, 2, admin)
+	mock.ExpectExec(quoteSQL("UPDATE users SET role = $1, is_active = $2, token_version = token_version + 1")).
+		WithArgs("trader", true, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(quoteSQL("INSERT INTO user_audit")).
+		WithArgs(1, auditRoleChanged, 1, jsonWith(`"role":"admin"`), jsonWith(`"role":"trader"`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	if w := adminRequest(adminRouter(), http.MethodPut, "/auth/admin/users/1/role", `{"role":"trader"}`); w.Code != http.StatusOK {
+		t.Errorf("With another admin: expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestUserAudit проверяет записи user_audit: снимки до и после, отзыв токенов
+// при деактивации, отсутствие записи без изменений
+func TestUserAudit(t *testing.T) {
+	trader := User{ID: 2, Email: "trader@quotopia.com", Role: "trader", IsActive: true}
+
+	t.Run("deactivated", func(t *testing.T) {
+		mock := mockDB(t)
+		expectModifyUser(mock, 1, trader)
+		mock.ExpectExec(quoteSQL("UPDATE users SET role = $1, is_active = $2")).
+			WithArgs("trader", false, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(quoteSQL("UPDATE users SET token_version = token_version + 1")).
+			WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(quoteSQL("UPDATE refresh_tokens SET revoked_at = NOW()")).
+			WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(quoteSQL("INSERT INTO user_audit")).
+			WithArgs(2, auditDeactivated, 1, jsonWith(`"is_active":true`), jsonWith(`"is_active":false`)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		if w := adminRequest(adminRouter(), http.MethodPut, "/auth/admin/users/2/status", `{"is_active":false}`); w.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		mock := mockDB(t)
+		expectModifyUser(mock, 1, trader)
+		// Аудит пишется до удаления, new_data - NULL
+		mock.ExpectExec(quoteSQL("INSERT INTO user_audit")).
+			WithArgs(2, auditDeleted, 1, jsonWith(`"email":"trader@quotopia.com"`), nilJSON).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(quoteSQL("DELETE FROM users WHERE id = $1")).
+			WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if w := adminRequest(adminRouter(), http.MethodDelete, "/auth/admin/users/2", ""); w.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		mock := mockDB(t)
+		expectModifyUser(mock, 1, trader)
+		mock.ExpectRollback()
+
+		if w := adminRequest(adminRouter(), http.MethodPut, "/auth/admin/users/2/role", `{"role":"trader"}`); w.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock := mockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(quoteSQL("SELECT id FROM users WHERE role = 'admin'")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(quoteSQL("FROM users WHERE id = $1")).WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectRollback()
+
+		if w := adminRequest(adminRouter(), http.MethodDelete, "/auth/admin/users/9", ""); w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", w.Code)
+		}
+	})
+}
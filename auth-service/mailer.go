@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string // Обычный текст
+}
+
+// Mailer отправка писем (сброс пароля и т.п.)
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// openMailer выбирает способ отправки по MAILER: log, file или smtp. Без
+// MAILER возвращает nil: письма со ссылкой сброса никуда не уходят, и сброс
+// пароля выключен, а не пишет токены в лог по умолчанию.
+func openMailer() (Mailer, error) {
+	from := getEnv("MAIL_FROM", "Quotopia <no-reply@quotopia.com>")
+	switch backend := getEnv("MAILER", ""); backend {
+	case "":
+		return nil, nil
+	case "log":
+		return LogMailer{}, nil
+	case "file":
+		return NewFileMailer(getEnv("MAIL_FILE", "./data/mail.log"), from), nil
+	case "smtp":
+		host := getEnv("SMTP_HOST", "")
+		if host == "" {
+			return nil, fmt.Errorf("для MAILER=smtp нужен SMTP_HOST")
+		}
+		return NewSMTPMailer(host, getEnv("SMTP_PORT", "587"), getEnv("SMTP_USER", ""), getEnv("SMTP_PASSWORD", ""), from), nil
+	default:
+		return nil, fmt.Errorf("неизвестный MAILER %q (ожидается log, file или smtp)", backend)
+	}
+}
+
+// LogMailer пишет письма в лог вместо отправки (локальная разработка, только
+// явным MAILER=log). Тело письма содержит ссылку со сбросом пароля - не для production.
+type LogMailer struct{}
+
+// Send реализует Mailer
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.Info("📧 Письмо (MAILER=log)", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer дописывает письма в файл в формате RFC 5322 (dev окружения, тесты)
+type FileMailer struct {
+	path string
+	from string
+	now  func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewFileMailer создаёт отправку в файл path
+func NewFileMailer(path, from string) *FileMailer {
+	return &FileMailer{path: path, from: from, now: time.Now}
+}
+
+// Send реализует Mailer
+func (f *FileMailer) Send(ctx context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(formatMessage(f.from, msg, f.now())); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SMTPMailer отправляет письма через SMTP сервер (STARTTLS, если сервер его поддерживает)
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer создаёт отправку через host:port; без user - без авторизации
+func NewSMTPMailer(host, port, user, password, from string) *SMTPMailer {
+	m := &SMTPMailer{addr: net.JoinHostPort(host, port), from: from}
+	if user != "" {
+		m.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return m
+}
+
+// Send реализует Mailer. net/smtp не принимает контекст: отправка идёт в
+// отдельной горутине, а Send возвращается по отмене ctx.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	envelopeFrom := m.from
+	if addr, err := parseAddress(m.from); err == nil {
+		envelopeFrom = addr
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, m.auth, envelopeFrom, []string{msg.To}, formatMessage(m.from, msg, time.Now()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseAddress адрес из "Имя <addr>"
+func parseAddress(from string) (string, error) {
+	start, end := strings.LastIndex(from, "<"), strings.LastIndex(from, ">")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("нет адреса в %q", from)
+	}
+	return from[start+1 : end], nil
+}
+
+// formatMessage собирает письмо с заголовками; тема кодируется для не-ASCII символов
+func formatMessage(from string, msg Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFileMailer проверяет, что письма дописываются в файл с заголовками
+func TestFileMailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail", "out.log")
+	m := NewFileMailer(path, "Quotopia <no-reply@quotopia.com>")
+	m.now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	for _, to := range []string{"first@quotopia.com", "second@quotopia.com"} {
+		err := m.Send(context.Background(), Message{To: to, Subject: "Сброс пароля", Body: "line 1\nline 2"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, want := range []string{
+		"To: first@quotopia.com\r\n",
+		"To: second@quotopia.com\r\n",
+		"Subject: =?utf-8?q?",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000\r\n",
+		"\r\n\r\nline 1\r\nline 2\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Mail file should contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+// TestOpenMailer проверяет выбор отправки по MAILER
+func TestOpenMailer(t *testing.T) {
+	// Без MAILER письма не отправляются и токены сброса не попадают в лог
+	if m, err := openMailer(); err != nil || m != nil {
+		t.Errorf("Expected no mailer by default, got %T %v", m, err)
+	}
+
+	t.Setenv("MAILER", "log")
+	if m, err := openMailer(); err != nil {
+		t.Errorf("Log mailer failed: %v", err)
+	} else if _, ok := m.(LogMailer); !ok {
+		t.Errorf("Expected LogMailer, got %T", m)
+	}
+
+	t.Setenv("MAILER", "smtp")
+	if _, err := openMailer(); err == nil {
+		t.Error("SMTP mailer without SMTP_HOST should fail")
+	}
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	if m, err := openMailer(); err != nil {
+		t.Errorf("SMTP mailer failed: %v", err)
+	} else if m.(*SMTPMailer).addr != "smtp.example.com:587" {
+		t.Errorf("Unexpected SMTP address %q", m.(*SMTPMailer).addr)
+	}
+
+	t.Setenv("MAILER", "pigeon")
+	if _, err := openMailer(); err == nil {
+		t.Error("Unknown mailer should fail")
+	}
+}
+
+// TestParseAddress проверяет адрес конверта SMTP
+func TestParseAddress(t *testing.T) {
+	if addr, err := parseAddress("Quotopia <no-reply@quotopia.com>"); err != nil || addr != "no-reply@quotopia.com" {
+		t.Errorf("Expected no-reply@quotopia.com, got %q %v", addr, err)
+	}
+	if _, err := parseAddress("no-reply@quotopia.com"); err == nil {
+		t.Error("Address without brackets should fail")
+	}
+}
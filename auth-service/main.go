@@ -1,24 +1,69 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"ft-mt/internal/logging"
+	"ft-mt/internal/metrics"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Конфигурация
 var (
-	jwtSecret = []byte(getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"))
-	db        *sql.DB
+	jwtSecret   = []byte(getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"))
+	db          *sql.DB
+	revocations RevocationStore
+	mailer      Mailer
 )
 
+// Метрики auth-service
+var (
+	loginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_attempts_total",
+		Help: "Попытки входа по результату: success, invalid_credentials, inactive.",
+	}, []string{"result"})
+	registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Зарегистрированные пользователи.",
+	})
+	tokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_tokens_issued_total",
+		Help: "Выданные токены по типу: access, refresh.",
+	}, []string{"type"})
+	refreshReuse = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_refresh_token_reuse_total",
+		Help: "Повторно предъявленные refresh токены (семейство отозвано).",
+	})
+	logouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logouts_total",
+		Help: "Выходы по охвату: session (текущий токен), all (все устройства).",
+	}, []string{"scope"})
+	passwordChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_password_changes_total",
+		Help: "Смены пароля по способу: change, reset_requested, reset.",
+	}, []string{"kind"})
+)
+
+func init() {
+	prometheus.MustRegister(loginAttempts, registrations, tokensIssued, refreshReuse, logouts, passwordChanges)
+}
+
 // User модель пользователя
 type User struct {
 	ID           int        `json:"id"`
@@ -28,13 +73,14 @@ type User struct {
 	IsActive     bool       `json:"is_active"`
 	CreatedAt    time.Time  `json:"created_at"`
 	LastLogin    *time.Time `json:"last_login,omitempty"`
+	TokenVersion int        `json:"-"` // Увеличивается при выходе на всех устройствах
 }
 
 // RegisterRequest запрос на регистрацию
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
-	Role     string `json:"role"` // По умолчанию "user"
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=8,password"`
+	InviteCode string `json:"invite_code"` // Обязателен при REGISTRATION_POLICY=invite
 }
 
 // LoginRequest запрос на вход
@@ -43,6 +89,16 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshRequest запрос на обмен refresh токена
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest запрос на выход; refresh_token необязателен
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // TokenResponse ответ с токеном
 type TokenResponse struct {
 	Token        string    `json:"token"`
@@ -53,13 +109,22 @@ type TokenResponse struct {
 
 // JWTClaims кастомные claims для JWT
 type JWTClaims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID  int    `json:"user_id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Type    string `json:"typ"`           // access или refresh
+	Version int    `json:"ver,omitempty"` // Версия токенов пользователя (только access)
+	// SessionID семейство refresh токенов входа (только access): выход отзывает его
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 func main() {
+	if err := logging.Setup("auth"); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки логов: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Подключение к БД
 	dbHost := getEnv("DB_HOST", "postgres")
 	dbPort := getEnv("DB_PORT", "5432")
@@ -73,21 +138,80 @@ func main() {
 	var err error
 	db, err = sql.Open("postgres", connStr)
 	if err != nil {
-		log.Fatalf("❌ Не удалось подключиться к БД: %v", err)
+		logging.Fatal("❌ Не удалось подключиться к БД", "error", err)
 	}
 	defer db.Close()
 
 	// Проверка подключения
 	if err = db.Ping(); err != nil {
-		log.Fatalf("❌ БД не отвечает: %v", err)
+		logging.Fatal("❌ БД не отвечает", "error", err)
+	}
+	slog.Info("✅ Подключено к PostgreSQL")
+
+	// Хранилище отозванных access токенов
+	revocations, err = openRevocationStore(db)
+	if err != nil {
+		logging.Fatal("❌ Ошибка хранилища отзывов", "error", err)
+	}
+	pruneInterval, err := time.ParseDuration(getEnv("REVOCATION_PRUNE_INTERVAL", defaultRevocationPruneInterval.String()))
+	if err != nil || pruneInterval <= 0 {
+		logging.Fatal("❌ Некорректный REVOCATION_PRUNE_INTERVAL", "value", getEnv("REVOCATION_PRUNE_INTERVAL", ""))
+	}
+	pruneCtx, stopPrune := context.WithCancel(context.Background())
+	defer stopPrune()
+	go runRevocationPruner(pruneCtx, revocations, pruneInterval)
+	slog.Info("🔒 Хранилище отзывов токенов", "store", getEnv("REVOCATION_STORE", "memory"))
+
+	// Отправка писем (сброс пароля)
+	mailer, err = openMailer()
+	if err != nil {
+		logging.Fatal("❌ Ошибка настройки почты", "error", err)
+	}
+	passwordResetTTL, err = time.ParseDuration(getEnv("PASSWORD_RESET_TTL", defaultPasswordResetTTL.String()))
+	if err != nil || passwordResetTTL <= 0 {
+		logging.Fatal("❌ Некорректный PASSWORD_RESET_TTL", "value", getEnv("PASSWORD_RESET_TTL", ""))
+	}
+	if mailer == nil {
+		slog.Warn("⚠️ MAILER не задан, сброс пароля по email выключен")
+	} else {
+		slog.Info("📧 Почта", "mailer", getEnv("MAILER", ""))
+	}
+	emailLimit, err := strconv.Atoi(getEnv("PASSWORD_RESET_EMAIL_LIMIT", strconv.Itoa(defaultPasswordResetEmailLimit)))
+	if err != nil || emailLimit <= 0 {
+		logging.Fatal("❌ Некорректный PASSWORD_RESET_EMAIL_LIMIT", "value", getEnv("PASSWORD_RESET_EMAIL_LIMIT", ""))
+	}
+	ipLimit, err := strconv.Atoi(getEnv("PASSWORD_RESET_IP_LIMIT", strconv.Itoa(defaultPasswordResetIPLimit)))
+	if err != nil || ipLimit <= 0 {
+		logging.Fatal("❌ Некорректный PASSWORD_RESET_IP_LIMIT", "value", getEnv("PASSWORD_RESET_IP_LIMIT", ""))
 	}
-	log.Println("✅ Подключено к PostgreSQL")
+	resetEmailLimiter = NewRateLimiter(emailLimit, passwordResetLimitWindow)
+	resetIPLimiter = NewRateLimiter(ipLimit, passwordResetLimitWindow)
+
+	// Политика регистрации
+	registrationPolicy, err = parseRegistrationPolicy(getEnv("REGISTRATION_POLICY", registrationOpen))
+	if err != nil {
+		logging.Fatal("❌ Некорректный REGISTRATION_POLICY", "error", err)
+	}
+	inviteTTL, err = time.ParseDuration(getEnv("INVITE_TTL", defaultInviteTTL.String()))
+	if err != nil || inviteTTL <= 0 {
+		logging.Fatal("❌ Некорректный INVITE_TTL", "value", getEnv("INVITE_TTL", ""))
+	}
+	slog.Info("📝 Регистрация", "policy", registrationPolicy)
 
 	// Создание роутера
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// IP клиента (лимиты сброса пароля) берётся из X-Forwarded-For только от
+	// TRUSTED_PROXIES (nginx), иначе - адрес соединения
+	if err := r.SetTrustedProxies(parseTrustedProxies(getEnv("TRUSTED_PROXIES", ""))); err != nil {
+		logging.Fatal("❌ Некорректный TRUSTED_PROXIES", "value", getEnv("TRUSTED_PROXIES", ""), "error", err)
+	}
 
 	// CORS middleware
 	r.Use(corsMiddleware())
+	r.Use(logging.GinMiddleware())
+	r.Use(metrics.GinMiddleware())
 
 	// Публичные endpoints
 	public := r.Group("/auth")
@@ -95,6 +219,8 @@ func main() {
 		public.POST("/register", register)
 		public.POST("/login", login)
 		public.POST("/refresh", refreshToken)
+		public.POST("/password/forgot", forgotPassword)
+		public.POST("/password/reset", resetPassword)
 	}
 
 	// Защищённые endpoints
@@ -103,6 +229,7 @@ func main() {
 	{
 		protected.GET("/me", getCurrentUser)
 		protected.POST("/logout", logout)
+		protected.POST("/logout/all", logoutAll)
 		protected.PUT("/password", changePassword)
 	}
 
@@ -111,7 +238,10 @@ func main() {
 	admin.Use(authMiddleware(), adminMiddleware())
 	{
 		admin.GET("/users", listUsers)
+		admin.POST("/users", adminCreateUser)
+		admin.POST("/invites", createInvite)
 		admin.PUT("/users/:id/role", changeUserRole)
+		admin.PUT("/users/:id/status", changeUserStatus)
 		admin.DELETE("/users/:id", deleteUser)
 	}
 
@@ -121,17 +251,47 @@ func main() {
 	})
 
 	port := getEnv("PORT", "8090")
-	log.Printf("🚀 Auth Service запущен на порту %s", port)
-	log.Printf("📚 Endpoints:")
-	log.Printf("   POST   /auth/register    - Регистрация")
-	log.Printf("   POST   /auth/login       - Вход")
-	log.Printf("   GET    /auth/me          - Текущий пользователь")
-	log.Printf("   POST   /auth/refresh     - Обновить токен")
-	log.Printf("   GET    /health           - Health check")
+	slog.Info("🚀 Auth Service запущен", "port", port)
+	for _, route := range r.Routes() {
+		slog.Debug("📚 Endpoint", "method", route.Method, "path", route.Path)
+	}
 
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("❌ Ошибка запуска сервера: %v", err)
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "10s"))
+	if err != nil {
+		logging.Fatal("❌ Некорректный SHUTDOWN_TIMEOUT", "error", err)
 	}
+
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("❌ Ошибка запуска сервера", "error", err)
+		}
+	}()
+
+	// Prometheus метрики на отдельном HTTP порту: nginx проксирует только PORT
+	metricsServer := &http.Server{Addr: getEnv("METRICS_ADDR", ":9102"), Handler: metrics.Handler()}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("⚠️ Сервер метрик остановлен", "error", err)
+		}
+	}()
+
+	// Ждём SIGINT/SIGTERM и даём текущим запросам завершиться до закрытия БД
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signals.Done()
+	stop()
+
+	slog.Info("🛑 Остановка Auth Service, ожидание завершения запросов", "timeout", shutdownTimeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("⚠️ Не все запросы завершились", "error", err)
+	}
+	metricsServer.Close()
+	// Ссылки сброса пароля отправляются после ответа
+	resetSends.Wait()
+	slog.Info("👋 Auth Service остановлен")
 }
 
 // register регистрация нового пользователя
@@ -141,10 +301,36 @@ func register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkRegistrationAllowed(c, req) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Код приглашения проверяется до email: иначе по 409 с выдуманным кодом
+	// можно было бы узнать, какие email зарегистрированы
+	var inviteID int
+	if registrationPolicy == registrationInvite {
+		inviteID, err = lockInvite(ctx, tx, req.InviteCode)
+		if errors.Is(err, errInviteInvalid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired invite code"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
 
 	// Проверка существования пользователя
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", req.Email).Scan(&exists)
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", req.Email).Scan(&exists)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -154,57 +340,36 @@ func register(c *gin.Context) {
 		return
 	}
 
-	// Хеширование пароля
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-		return
+	// Создание пользователя. Роль всегда defaultRole: привилегированные
+	// аккаунты создаёт admin через POST /auth/admin/users
+	user, err := createUser(ctx, tx, req.Email, req.Password, defaultRole, true)
+	if err == nil && registrationPolicy == registrationInvite {
+		err = useInvite(ctx, tx, inviteID, user.ID)
 	}
-
-	// Роль по умолчанию
-	role := req.Role
-	if role == "" {
-		role = "user"
+	if err == nil {
+		err = tx.Commit()
 	}
-	// Только admin может создавать admin
-	// TODO: добавить проверку текущего пользователя
-
-	// Создание пользователя
-	var user User
-	err = db.QueryRow(`
-		INSERT INTO users (email, password_hash, role, is_active)
-		VALUES ($1, $2, $3, true)
-		RETURNING id, email, role, is_active, created_at
-	`, req.Email, string(hashedPassword), role).Scan(
-		&user.ID, &user.Email, &user.Role, &user.IsActive, &user.CreatedAt,
-	)
-	if err != nil {
-		log.Printf("❌ Ошибка создания пользователя: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if respondPasswordTooLong(c, err) {
 		return
 	}
-
-	// Генерация токена
-	token, expiresAt, err := generateToken(user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		logging.FromContext(ctx).Error("❌ Ошибка создания пользователя", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	refreshToken, err := generateRefreshToken(user)
+	// Генерация токенов
+	resp, err := issueTokens(ctx, db, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		logging.FromContext(ctx).Error("❌ Ошибка выдачи токенов", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	log.Printf("✅ Зарегистрирован новый пользователь: %s (role: %s)", user.Email, user.Role)
+	registrations.Inc()
+	logging.FromContext(ctx).Info("✅ Зарегистрирован новый пользователь", "user_id", user.ID, "email", user.Email, "role", user.Role)
 
-	c.JSON(http.StatusCreated, TokenResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		ExpiresAt:    expiresAt,
-		User:         user,
-	})
+	c.JSON(http.StatusCreated, resp)
 }
 
 // login вход пользователя
@@ -218,24 +383,26 @@ func login(c *gin.Context) {
 	// Поиск пользователя
 	var user User
 	err := db.QueryRow(`
-		SELECT id, email, password_hash, role, is_active, created_at, last_login
+		SELECT id, email, password_hash, role, is_active, created_at, last_login, token_version
 		FROM users WHERE email = $1
 	`, req.Email).Scan(
 		&user.ID, &user.Email, &user.PasswordHash, &user.Role,
-		&user.IsActive, &user.CreatedAt, &user.LastLogin,
+		&user.IsActive, &user.CreatedAt, &user.LastLogin, &user.TokenVersion,
 	)
 	if err == sql.ErrNoRows {
+		loginAttempts.WithLabelValues("invalid_credentials").Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 	if err != nil {
-		log.Printf("❌ Ошибка поиска пользователя: %v", err)
+		logging.FromContext(c.Request.Context()).Error("❌ Ошибка поиска пользователя", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	// Проверка активности
 	if !user.IsActive {
+		loginAttempts.WithLabelValues("inactive").Inc()
 		c.JSON(http.StatusForbidden, gin.H{"error": "User is inactive"})
 		return
 	}
@@ -243,6 +410,7 @@ func login(c *gin.Context) {
 	// Проверка пароля
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
+		loginAttempts.WithLabelValues("invalid_credentials").Inc()
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
@@ -250,30 +418,21 @@ func login(c *gin.Context) {
 	// Обновление last_login
 	_, err = db.Exec("UPDATE users SET last_login = NOW() WHERE id = $1", user.ID)
 	if err != nil {
-		log.Printf("⚠️ Не удалось обновить last_login: %v", err)
+		logging.FromContext(c.Request.Context()).Warn("⚠️ Не удалось обновить last_login", "error", err)
 	}
 
-	// Генерация токена
-	token, expiresAt, err := generateToken(user)
+	// Генерация токенов
+	resp, err := issueTokens(c.Request.Context(), db, user)
 	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("❌ Ошибка выдачи токенов", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	refreshToken, err := generateRefreshToken(user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
-		return
-	}
+	loginAttempts.WithLabelValues("success").Inc()
+	logging.FromContext(c.Request.Context()).Info("✅ Вход", "user_id", user.ID, "email", user.Email, "role", user.Role)
 
-	log.Printf("✅ Вход: %s (role: %s)", user.Email, user.Role)
-
-	c.JSON(http.StatusOK, TokenResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		ExpiresAt:    expiresAt,
-		User:         user,
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
 // getCurrentUser получить текущего пользователя
@@ -296,102 +455,111 @@ func getCurrentUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
-// refreshToken обновить токен
+// refreshToken обменивает refresh токен на новую пару access + refresh
 func refreshToken(c *gin.Context) {
-	// TODO: Реализовать логику refresh token
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
-}
-
-// logout выход
-func logout(c *gin.Context) {
-	// TODO: Инвалидация токена (добавить в blacklist)
-	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
-}
-
-// changePassword смена пароля
-func changePassword(c *gin.Context) {
-	// TODO: Реализовать смену пароля
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
-}
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logger := logging.FromContext(c.Request.Context())
 
-// listUsers список всех пользователей (только admin)
-func listUsers(c *gin.Context) {
-	rows, err := db.Query(`
-		SELECT id, email, role, is_active, created_at, last_login
-		FROM users ORDER BY created_at DESC
-	`)
+	claims, err := parseToken(req.RefreshToken, refreshTokenType)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
-	defer rows.Close()
 
-	users := []User{}
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.IsActive, &user.CreatedAt, &user.LastLogin)
-		if err != nil {
-			continue
-		}
-		users = append(users, user)
+	user, refreshToken, familyID, err := rotateRefreshToken(c.Request.Context(), req.RefreshToken)
+	switch {
+	case errors.Is(err, errRefreshReused):
+		refreshReuse.Inc()
+		logger.Warn("🚨 Повторное использование refresh токена, семейство отозвано", "user_id", claims.UserID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	case errors.Is(err, errRefreshInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	case errors.Is(err, errUserInactive):
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is inactive"})
+		return
+	case err != nil:
+		logger.Error("❌ Ошибка обмена refresh токена", "user_id", claims.UserID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
-	c.JSON(http.StatusOK, users)
-}
-
-// changeUserRole изменить роль пользователя (только admin)
-func changeUserRole(c *gin.Context) {
-	// TODO: Реализовать изменение роли
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
-}
+	token, expiresAt, err := generateToken(user, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
 
-// deleteUser удалить пользователя (только admin)
-func deleteUser(c *gin.Context) {
-	// TODO: Реализовать удаление пользователя
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
+	logger.Debug("🔄 Refresh токен обменян", "user_id", user.ID)
+	c.JSON(http.StatusOK, TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		User:         user,
+	})
 }
 
-// generateToken генерация JWT токена
-func generateToken(user User) (string, time.Time, error) {
-	expiresAt := time.Now().Add(1 * time.Hour) // 1 час
-
-	claims := JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "quotopia-auth",
-		},
+// logout выход: отзывает текущий access токен и семейство refresh токенов
+// этого входа (sid токена); переданный refresh токен отзывается тоже - для
+// токенов, выданных до появления sid
+func logout(c *gin.Context) {
+	var req LogoutRequest
+	// Тело необязательно: без него отзывается только access токен
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 	}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	userID := c.GetInt("user_id")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		return "", time.Time{}, err
+	if err := revocations.Revoke(ctx, c.GetString("jti"), c.GetTime("token_expires_at")); err != nil {
+		logger.Error("❌ Ошибка отзыва токена", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if sessionID := c.GetString("sid"); sessionID != "" {
+		if err := revokeSession(ctx, sessionID, userID); err != nil {
+			logger.Error("❌ Ошибка отзыва refresh токенов входа", "user_id", userID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh token"})
+			return
+		}
+	}
+	if req.RefreshToken != "" {
+		if err := revokeRefreshToken(ctx, req.RefreshToken, userID); err != nil {
+			logger.Error("❌ Ошибка отзыва refresh токена", "user_id", userID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh token"})
+			return
+		}
 	}
 
-	return tokenString, expiresAt, nil
+	logouts.WithLabelValues("session").Inc()
+	logger.Info("👋 Выход", "user_id", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
-// generateRefreshToken генерация refresh токена
-func generateRefreshToken(user User) (string, error) {
-	expiresAt := time.Now().Add(24 * 7 * time.Hour) // 7 дней
+// logoutAll выход на всех устройствах: все access и refresh токены пользователя
+// перестают действовать
+func logoutAll(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.GetInt("user_id")
 
-	claims := JWTClaims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "quotopia-auth-refresh",
-		},
+	if err := revokeAllTokens(ctx, userID); err != nil {
+		logging.FromContext(ctx).Error("❌ Ошибка выхода на всех устройствах", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	logouts.WithLabelValues("all").Inc()
+	logging.FromContext(ctx).Info("👋 Выход на всех устройствах", "user_id", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices"})
 }
 
 // authMiddleware middleware для проверки JWT
@@ -409,20 +577,22 @@ func authMiddleware() gin.HandlerFunc {
 			tokenString = tokenString[7:]
 		}
 
-		// Парсинг токена
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
+		// Парсинг токена: refresh токен здесь не принимается
+		claims, err := parseToken(tokenString, accessTokenType)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(*JWTClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// Токен мог быть отозван выходом
+		if err := checkAccessToken(c.Request.Context(), claims); err != nil {
+			if errors.Is(err, errTokenRevoked) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			} else {
+				logging.FromContext(c.Request.Context()).Error("❌ Ошибка проверки отзыва токена", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+			}
 			c.Abort()
 			return
 		}
@@ -431,6 +601,9 @@ func authMiddleware() gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("role", claims.Role)
+		c.Set("jti", claims.ID)
+		c.Set("sid", claims.SessionID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
 
 		c.Next()
 	}
@@ -454,7 +627,8 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+logging.RequestIDHeader)
+		c.Writer.Header().Set("Access-Control-Expose-Headers", logging.RequestIDHeader)
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -463,6 +637,17 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
+// parseTrustedProxies разбирает список IP/CIDR через запятую; пустой - никому не доверять
+func parseTrustedProxies(value string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // getEnv получить переменную окружения с дефолтным значением
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
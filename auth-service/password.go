@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ft-mt/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordBytes bcrypt учитывает не больше 72 байт пароля; max=72 в теге
+// считал бы символы, и кириллический пароль из 37+ символов падал бы в bcrypt
+const maxPasswordBytes = 72
+
+// Правило binding:"password" - длина пароля в байтах не больше maxPasswordBytes
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+			return len(fl.Field().String()) <= maxPasswordBytes
+		})
+	}
+}
+
+// respondPasswordTooLong отвечает 400, если bcrypt отверг пароль по длине
+func respondPasswordTooLong(c *gin.Context, err error) bool {
+	if !errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "password must be at most 72 bytes"})
+	return true
+}
+
+// Сброс пароля: срок ссылки и лимиты запросов ссылки за passwordResetLimitWindow
+const (
+	defaultPasswordResetTTL        = 1 * time.Hour
+	defaultPasswordResetEmailLimit = 3
+	defaultPasswordResetIPLimit    = 20
+	passwordResetLimitWindow       = 1 * time.Hour
+	passwordResetSendTimeout       = 30 * time.Second
+)
+
+// Конфигурация сброса пароля
+var (
+	passwordResetTTL = defaultPasswordResetTTL
+	passwordResetURL = getEnv("PASSWORD_RESET_URL", "http://localhost:3001/reset-password")
+
+	// Лимиты считаются до поиска пользователя: одинаково для известных и неизвестных email
+	resetEmailLimiter = NewRateLimiter(defaultPasswordResetEmailLimit, passwordResetLimitWindow)
+	resetIPLimiter    = NewRateLimiter(defaultPasswordResetIPLimit, passwordResetLimitWindow)
+
+	// resetSends отправки ссылок, ещё идущие после ответа; ждём при остановке
+	resetSends sync.WaitGroup
+)
+
+// errResetInvalid токен сброса не найден, уже использован или истёк
+var errResetInvalid = errors.New("reset token is invalid or expired")
+
+// ChangePasswordRequest запрос на смену пароля
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,password"`
+}
+
+// ForgotPasswordRequest запрос ссылки для сброса пароля
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest сброс пароля по токену из письма
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8,password"`
+}
+
+// changePassword смена пароля: проверяет текущий пароль, отзывает все остальные
+// входы и возвращает новую пару токенов для текущего
+func changePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	userID := c.GetInt("user_id")
+
+	var passwordHash string
+	err := db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = $1", userID).Scan(&passwordHash)
+	if err != nil {
+		logger.Error("❌ Ошибка поиска пользователя", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)) != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	user, err := changeUserPassword(ctx, userID, req.NewPassword)
+	if respondPasswordTooLong(c, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("❌ Ошибка смены пароля", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// Текущий вход продолжается с токенами новой версии
+	resp, err := issueTokens(ctx, db, user)
+	if err != nil {
+		logger.Error("❌ Ошибка выдачи токенов", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	passwordChanges.WithLabelValues("change").Inc()
+	logger.Info("🔑 Пароль изменён, остальные входы отозваны", "user_id", userID)
+	c.JSON(http.StatusOK, resp)
+}
+
+// forgotPassword отправляет ссылку для сброса пароля. Ответ 202 одинаковый для
+// известных и неизвестных email и при ошибках БД или почты (они только
+// пишутся в лог), чтобы по нему нельзя было проверить наличие аккаунта.
+// Поиск пользователя и отправка идут после ответа: время ответа тоже не
+// зависит от наличия аккаунта.
+func forgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	if mailer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password reset is not configured"})
+		return
+	}
+	if !resetIPLimiter.Allow(c.ClientIP()) || !resetEmailLimiter.Allow(strings.ToLower(req.Email)) {
+		c.Header("Retry-After", fmt.Sprint(int(passwordResetLimitWindow.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many password reset requests"})
+		return
+	}
+
+	// Свой контекст: запрос завершится раньше отправки. Значения (request_id
+	// для логов) сохраняются
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), passwordResetSendTimeout)
+	resetSends.Add(1)
+	go func() {
+		defer resetSends.Done()
+		defer cancel()
+		if err := sendResetLink(sendCtx, req.Email); err != nil {
+			logger.Error("❌ Не удалось отправить ссылку сброса пароля", "error", err)
+		}
+	}()
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// sendResetLink выдаёт токен сброса и отправляет ссылку, если email принадлежит
+// активному пользователю; для неизвестного email ничего не делает
+func sendResetLink(ctx context.Context, email string) error {
+	logger := logging.FromContext(ctx)
+
+	var userID int
+	err := db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = $1 AND is_active", email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Debug("Сброс пароля для неизвестного email")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("поиск пользователя: %w", err)
+	}
+
+	token, err := createResetToken(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("создание токена сброса для user_id=%d: %w", userID, err)
+	}
+
+	err = mailer.Send(ctx, Message{
+		To:      email,
+		Subject: "Quotopia password reset",
+		Body: fmt.Sprintf("To reset your Quotopia password, open the link below.\n"+
+			"It is valid for %s and can be used once.\n\n%s?token=%s\n\n"+
+			"If you did not request a reset, ignore this email.",
+			passwordResetTTL, passwordResetURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return fmt.Errorf("отправка письма для user_id=%d: %w", userID, err)
+	}
+
+	passwordChanges.WithLabelValues("reset_requested").Inc()
+	logger.Info("📧 Отправлена ссылка сброса пароля", "user_id", userID)
+	return nil
+}
+
+// resetPassword устанавливает новый пароль по токену из письма и отзывает все входы
+func resetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+
+	userID, err := consumeResetToken(ctx, req.Token, req.NewPassword)
+	if errors.Is(err, errResetInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if respondPasswordTooLong(c, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("❌ Ошибка сброса пароля", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	passwordChanges.WithLabelValues("reset").Inc()
+	logger.Info("🔑 Пароль сброшен, все входы отозваны", "user_id", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// createResetToken выдаёт токен сброса; предыдущие неиспользованные токены
+// пользователя перестают действовать
+func createResetToken(ctx context.Context, userID int) (string, error) {
+	token, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+	`, userID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, hashToken(token), time.Now().Add(passwordResetTTL))
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// consumeResetToken гасит токен сброса и меняет пароль в одной транзакции
+func consumeResetToken(ctx context.Context, token, password string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id FROM password_reset_tokens
+		WHERE token = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, hashToken(token)).Scan(&id, &userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errResetInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1", id); err != nil {
+		return 0, err
+	}
+	if _, err := setPassword(ctx, tx, userID, password); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// changeUserPassword setPassword в собственной транзакции
+func changeUserPassword(ctx context.Context, userID int, password string) (User, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	user, err := setPassword(ctx, tx, userID, password)
+	if err != nil {
+		return user, err
+	}
+	return user, tx.Commit()
+}
+
+// setPassword сохраняет хеш нового пароля и отзывает все токены пользователя;
+// возвращает пользователя с новой версией токенов
+func setPassword(ctx context.Context, tx *sql.Tx, userID int, password string) (User, error) {
+	var user User
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE users SET password_hash = $1 WHERE id = $2", string(hash), userID); err != nil {
+		return user, err
+	}
+	if err = revokeUserTokens(ctx, tx, userID); err != nil {
+		return user, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, email, role, is_active, created_at, last_login, token_version
+		FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.Role, &user.IsActive, &user.CreatedAt, &user.LastLogin, &user.TokenVersion)
+	return user, err
+}
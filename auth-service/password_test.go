@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestPasswordRequestValidation проверяет, что некорректные запросы
+// отклоняются до обращения к БД
+func TestPasswordRequestValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/auth/password", changePassword)
+	r.POST("/auth/password/forgot", forgotPassword)
+	r.POST("/auth/password/reset", resetPassword)
+
+	cases := []struct {
+		method, path, body string
+	}{
+		{http.MethodPut, "/auth/password", `{"current_password":"old-password"}`},
+		{http.MethodPut, "/auth/password", `{"current_password":"old-password","new_password":"short"}`},
+		{http.MethodPost, "/auth/password/forgot", `{"email":"not-an-email"}`},
+		{http.MethodPost, "/auth/password/reset", `{"new_password":"long-enough"}`},
+		{http.MethodPost, "/auth/password/reset", `{"token":"abc","new_password":"short"}`},
+		// bcrypt учитывает только первые 72 байта
+		{http.MethodPost, "/auth/password/reset", `{"token":"abc","new_password":"` + strings.Repeat("x", 73) + `"}`},
+		// 40 символов кириллицы - 80 байт
+		{http.MethodPost, "/auth/password/reset", `{"token":"abc","new_password":"` + strings.Repeat("я", 40) + `"}`},
+		{http.MethodPut, "/auth/password", `{"current_password":"old-password","new_password":"` + strings.Repeat("я", 40) + `"}`},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected 400, got %d", tc.method, tc.path, tc.body, w.Code)
+		}
+	}
+}
+
+// fakeMailer запоминает письма вместо отправки; release, если задан, держит
+// отправку до закрытия
+type fakeMailer struct {
+	mu      sync.Mutex
+	sent    []Message
+	err     error
+	release chan struct{}
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg Message) error {
+	if m.release != nil {
+		<-m.release
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return m.err
+}
+
+// usePasswordReset подменяет почту и лимиты запросов ссылки сброса
+func usePasswordReset(t *testing.T, m Mailer, emailLimit, ipLimit int) {
+	prevMailer, prevEmail, prevIP := mailer, resetEmailLimiter, resetIPLimiter
+	mailer = m
+	resetEmailLimiter = NewRateLimiter(emailLimit, time.Hour)
+	resetIPLimiter = NewRateLimiter(ipLimit, time.Hour)
+	t.Cleanup(func() { mailer, resetEmailLimiter, resetIPLimiter = prevMailer, prevEmail, prevIP })
+}
+
+func passwordRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/password/forgot", forgotPassword)
+	r.POST("/auth/password/reset", resetPassword)
+	return r
+}
+
+func post(r *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w
+}
+
+// forgot запрашивает ссылку сброса и ждёт фоновую отправку
+func forgot(r *gin.Engine, email string) *httptest.ResponseRecorder {
+	w := post(r, "/auth/password/forgot", `{"email":"`+email+`"}`)
+	resetSends.Wait()
+	return w
+}
+
+// expectUserLookup ожидает поиск активного пользователя по email
+func expectUserLookup(mock sqlmock.Sqlmock, email string, userID int) {
+	query := mock.ExpectQuery(quoteSQL("SELECT id FROM users WHERE email = $1 AND is_active")).WithArgs(email)
+	if userID == 0 {
+		query.WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		return
+	}
+	query.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+}
+
+// expectCreateResetToken ожидает выдачу токена сброса с отменой прежних
+func expectCreateResetToken(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectBegin()
+	mock.ExpectExec(quoteSQL("UPDATE password_reset_tokens SET used_at = NOW()")).
+		WithArgs(userID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(quoteSQL("INSERT INTO password_reset_tokens")).
+		WithArgs(userID, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+// TestForgotPasswordAlwaysAccepted проверяет, что ответ не зависит ни от
+// наличия аккаунта, ни от ошибок БД и почты
+func TestForgotPasswordAlwaysAccepted(t *testing.T) {
+	mock := mockDB(t)
+	m := &fakeMailer{}
+	usePasswordReset(t, m, 10, 10)
+	r := passwordRouter()
+
+	expectUserLookup(mock, "ghost@quotopia.com", 0)
+	mock.ExpectQuery(quoteSQL("SELECT id FROM users")).WithArgs("broken@quotopia.com").
+		WillReturnError(errors.New("connection refused"))
+	expectUserLookup(mock, "user@quotopia.com", 3)
+	expectCreateResetToken(mock, 3)
+
+	var bodies []string
+	for _, email := range []string{"ghost@quotopia.com", "broken@quotopia.com", "user@quotopia.com"} {
+		w := forgot(r, email)
+		if w.Code != http.StatusAccepted {
+			t.Errorf("%s: expected 202, got %d", email, w.Code)
+		}
+		bodies = append(bodies, w.Body.String())
+	}
+	if bodies[0] != bodies[1] || bodies[1] != bodies[2] {
+		t.Errorf("Responses should be identical: %q", bodies)
+	}
+	if len(m.sent) != 1 || m.sent[0].To != "user@quotopia.com" {
+		t.Errorf("Expected one email to the registered user, got %+v", m.sent)
+	}
+
+	// Ошибка отправки письма тоже не меняет ответ
+	m.err = errors.New("smtp: 554 rejected")
+	expectUserLookup(mock, "user@quotopia.com", 3)
+	expectCreateResetToken(mock, 3)
+	if w := forgot(r, "user@quotopia.com"); w.Code != http.StatusAccepted || w.Body.String() != bodies[0] {
+		t.Errorf("Mailer error: expected the same 202, got %d %s", w.Code, w.Body)
+	}
+}
+
+// TestForgotPasswordLimits проверяет лимиты по email (без учёта регистра) и IP
+// и выключенный сброс без MAILER
+func TestForgotPasswordLimits(t *testing.T) {
+	mock := mockDB(t)
+	usePasswordReset(t, &fakeMailer{}, 1, 2)
+	r := passwordRouter()
+
+	expectUserLookup(mock, "ghost@quotopia.com", 0)
+	if w := forgot(r, "ghost@quotopia.com"); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+	// Лимит email исчерпан: запрос в БД не уходит
+	if w := post(r, "/auth/password/forgot", `{"email":"Ghost@Quotopia.com"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Email limit: expected 429, got %d", w.Code)
+	}
+	// Лимит IP (2) исчерпан двумя запросами выше
+	if w := post(r, "/auth/password/forgot", `{"email":"other@quotopia.com"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("IP limit: expected 429, got %d", w.Code)
+	}
+
+	usePasswordReset(t, nil, 10, 10)
+	if w := post(r, "/auth/password/forgot", `{"email":"ghost@quotopia.com"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Without MAILER: expected 503, got %d", w.Code)
+	}
+}
+
+// TestForgotPasswordRespondsFirst проверяет, что ответ не ждёт поиска
+// пользователя и отправки письма
+func TestForgotPasswordRespondsFirst(t *testing.T) {
+	mock := mockDB(t)
+	m := &fakeMailer{release: make(chan struct{})}
+	usePasswordReset(t, m, 10, 10)
+	r := passwordRouter()
+
+	expectUserLookup(mock, "user@quotopia.com", 3)
+	expectCreateResetToken(mock, 3)
+	if w := post(r, "/auth/password/forgot", `{"email":"user@quotopia.com"}`); w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 before sending, got %d", w.Code)
+	}
+	close(m.release)
+	resetSends.Wait()
+	if len(m.sent) != 1 {
+		t.Errorf("Expected reset email after response, got %d", len(m.sent))
+	}
+}
+
+// TestForgotPasswordTrustedProxies проверяет, что лимит IP нельзя обойти
+// подменой X-Forwarded-For, если запрос пришёл не от доверенного прокси
+func TestForgotPasswordTrustedProxies(t *testing.T) {
+	if got := parseTrustedProxies(" 172.28.0.10, ,10.0.0.0/8"); len(got) != 2 || got[0] != "172.28.0.10" || got[1] != "10.0.0.0/8" {
+		t.Errorf("Unexpected proxies %q", got)
+	}
+	if got := parseTrustedProxies(""); got != nil {
+		t.Errorf("Empty TRUSTED_PROXIES should trust nobody, got %q", got)
+	}
+
+	forgotFrom := func(r *gin.Engine, forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/password/forgot", strings.NewReader(`{"email":"ghost@quotopia.com"}`))
+		req.RemoteAddr = "172.28.0.10:40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		r.ServeHTTP(w, req)
+		resetSends.Wait()
+		return w.Code
+	}
+
+	// Без доверенных прокси ключ - адрес соединения
+	mock := mockDB(t)
+	usePasswordReset(t, &fakeMailer{}, 10, 1)
+	r := passwordRouter()
+	r.SetTrustedProxies(nil)
+	expectUserLookup(mock, "ghost@quotopia.com", 0)
+	if code := forgotFrom(r, "203.0.113.1"); code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", code)
+	}
+	if code := forgotFrom(r, "203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Errorf("Spoofed X-Forwarded-For: expected 429, got %d", code)
+	}
+
+	// От nginx ключ - клиент из X-Forwarded-For
+	usePasswordReset(t, &fakeMailer{}, 10, 1)
+	r.SetTrustedProxies([]string{"172.28.0.10"})
+	expectUserLookup(mock, "ghost@quotopia.com", 0)
+	expectUserLookup(mock, "ghost@quotopia.com", 0)
+	for _, client := range []string{"203.0.113.1", "203.0.113.2"} {
+		if code := forgotFrom(r, client); code != http.StatusAccepted {
+			t.Errorf("Client %s behind nginx: expected 202, got %d", client, code)
+		}
+	}
+}
+
+// TestResetPasswordOneTime проверяет, что токен из письма меняет пароль один
+// раз и отзывает все входы
+func TestResetPasswordOneTime(t *testing.T) {
+	mock := mockDB(t)
+	m := &fakeMailer{}
+	usePasswordReset(t, m, 10, 10)
+	r := passwordRouter()
+
+	expectUserLookup(mock, "user@quotopia.com", 3)
+	expectCreateResetToken(mock, 3)
+	forgot(r, "user@quotopia.com")
+	if len(m.sent) != 1 {
+		t.Fatalf("Expected reset email, got %d", len(m.sent))
+	}
+	_, token, _ := strings.Cut(m.sent[0].Body, "?token=")
+	token, _, _ = strings.Cut(token, "\n")
+
+	// Первое использование: токен гасится, пароль меняется, токены отзываются
+	mock.ExpectBegin()
+	mock.ExpectQuery(quoteSQL("FROM password_reset_tokens")).WithArgs(hashToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 3))
+	mock.ExpectExec(quoteSQL("UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1")).
+		WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(quoteSQL("UPDATE users SET password_hash = $1 WHERE id = $2")).
+		WithArgs(sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(quoteSQL("UPDATE users SET token_version = token_version + 1")).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(quoteSQL("UPDATE refresh_tokens SET revoked_at = NOW()")).
+		WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(quoteSQL("FROM users WHERE id = $1")).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "is_active", "created_at", "last_login", "token_version"}).
+			AddRow(3, "user@quotopia.com", "user", true, time.Now(), nil, 1))
+	mock.ExpectCommit()
+
+	body := `{"token":"` + token + `","new_password":"new-password-1"}`
+	if w := post(r, "/auth/password/reset", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+
+	// Повторное использование: токен уже погашен
+	mock.ExpectBegin()
+	mock.ExpectQuery(quoteSQL("FROM password_reset_tokens")).WithArgs(hashToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}))
+	mock.ExpectRollback()
+	if w := post(r, "/auth/password/reset", body); w.Code != http.StatusBadRequest {
+		t.Errorf("Reused token: expected 400, got %d", w.Code)
+	}
+}
+
+// TestPasswordTooLong проверяет, что отказ bcrypt по длине - это 400, а не 500
+func TestPasswordTooLong(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	_, err := bcrypt.GenerateFromPassword([]byte(strings.Repeat("я", 37)), bcrypt.DefaultCost)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	if !respondPasswordTooLong(c, err) || w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for %v, got %d", err, w.Code)
+	}
+	if respondPasswordTooLong(c, errors.New("connection refused")) {
+		t.Error("Other errors should not be reported as too long")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter ограничивает число событий на ключ (email, IP) в фиксированном
+// окне. Состояние в памяти процесса: для одного экземпляра auth-service.
+type RateLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	windows   map[string]rateWindow
+	lastPrune time.Time
+}
+
+// rateWindow начало текущего окна ключа и число событий в нём
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// NewRateLimiter допускает limit событий на ключ за window
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window, now: time.Now, windows: make(map[string]rateWindow)}
+}
+
+// Allow учитывает событие ключа; false - лимит текущего окна исчерпан
+func (l *RateLimiter) Allow(key string) bool {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Окна, истёкшие больше окна назад, удаляются не чаще раза в окно
+	if now.Sub(l.lastPrune) >= l.window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = rateWindow{start: now}
+	}
+	if w.count >= l.limit {
+		return false
+	}
+	w.count++
+	l.windows[key] = w
+	return true
+}
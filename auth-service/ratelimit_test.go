@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRateLimiter проверяет лимит на ключ и новое окно после истечения
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(2, time.Hour)
+	l.now = func() time.Time { return now }
+
+	if !l.Allow("a") || !l.Allow("a") {
+		t.Fatal("First events within the limit should be allowed")
+	}
+	if l.Allow("a") {
+		t.Error("Event over the limit should be rejected")
+	}
+	if !l.Allow("b") {
+		t.Error("Limit is per key")
+	}
+
+	now = now.Add(time.Hour)
+	if !l.Allow("a") {
+		t.Error("New window should allow events again")
+	}
+	if len(l.windows) != 1 {
+		t.Errorf("Expired windows should be pruned, got %d", len(l.windows))
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"ft-mt/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Политики публичной регистрации (REGISTRATION_POLICY)
+const (
+	registrationOpen     = "open"     // Любой может зарегистрироваться
+	registrationInvite   = "invite"   // Только с кодом приглашения от admin
+	registrationDisabled = "disabled" // Пользователей создаёт только admin
+)
+
+// defaultRole роль пользователей, зарегистрировавшихся самостоятельно
+const defaultRole = "user"
+
+// defaultInviteTTL сколько действует код приглашения
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+// Конфигурация регистрации
+var (
+	registrationPolicy = registrationOpen
+	inviteTTL          = defaultInviteTTL
+)
+
+// errInviteInvalid код приглашения не найден, уже использован или истёк
+var errInviteInvalid = errors.New("invite code is invalid or expired")
+
+// CreateUserRequest создание пользователя администратором
+type CreateUserRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,password"`
+	Role     string `json:"role" binding:"required"`
+	IsActive *bool  `json:"is_active"` // По умолчанию true
+}
+
+// CreateInviteRequest запрос кода приглашения; expires_in - длительность ("72h")
+type CreateInviteRequest struct {
+	ExpiresIn string `json:"expires_in"`
+}
+
+// parseRegistrationPolicy проверяет значение REGISTRATION_POLICY
+func parseRegistrationPolicy(value string) (string, error) {
+	switch value {
+	case registrationOpen, registrationInvite, registrationDisabled:
+		return value, nil
+	default:
+		return "", fmt.Errorf("неизвестная политика регистрации %q (ожидается open, invite или disabled)", value)
+	}
+}
+
+// checkRegistrationAllowed отвечает 403, если политика не пускает запрос
+func checkRegistrationAllowed(c *gin.Context, req RegisterRequest) bool {
+	switch {
+	case registrationPolicy == registrationDisabled:
+		c.JSON(http.StatusForbidden, gin.H{"error": "Registration is disabled"})
+		return false
+	case registrationPolicy == registrationInvite && req.InviteCode == "":
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invite code required"})
+		return false
+	}
+	return true
+}
+
+// createUser создаёт пользователя в транзакции tx
+func createUser(ctx context.Context, tx *sql.Tx, email, password, role string, active bool) (User, error) {
+	var user User
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return user, err
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, password_hash, role, is_active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, email, role, is_active, created_at, token_version
+	`, email, string(hash), role, active).Scan(
+		&user.ID, &user.Email, &user.Role, &user.IsActive, &user.CreatedAt, &user.TokenVersion,
+	)
+	return user, err
+}
+
+// lockInvite находит действующий код приглашения и блокирует его до конца
+// транзакции: при одновременной регистрации с одним кодом пройдёт только одна
+func lockInvite(ctx context.Context, tx *sql.Tx, code string) (int, error) {
+	var id int
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM invite_codes
+		WHERE code = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, hashToken(code)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errInviteInvalid
+	}
+	return id, err
+}
+
+// useInvite гасит заблокированный lockInvite код за пользователем userID
+func useInvite(ctx context.Context, tx *sql.Tx, inviteID, userID int) error {
+	_, err := tx.ExecContext(ctx, "UPDATE invite_codes SET used_by = $2, used_at = NOW() WHERE id = $1", inviteID, userID)
+	return err
+}
+
+// adminCreateUser создать пользователя с любой ролью (только admin)
+func adminCreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validRoles[req.Role] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of admin, trader, user, viewer"})
+		return
+	}
+	active := req.IsActive == nil || *req.IsActive
+	ctx := c.Request.Context()
+	logger := logging.FromContext(ctx)
+	adminID := c.GetInt("user_id")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", req.Email).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+		return
+	}
+
+	user, err := createUser(ctx, tx, req.Email, req.Password, req.Role, active)
+	if err == nil {
+		err = writeUserAudit(ctx, tx, adminID, user.ID, auditCreated, nil, &user)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if respondPasswordTooLong(c, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("❌ Ошибка создания пользователя", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	logger.Info("🛡️ Пользователь создан администратором", "admin_id", adminID, "user_id", user.ID, "email", user.Email, "role", user.Role)
+	c.JSON(http.StatusCreated, user)
+}
+
+// createInvite выдаёт одноразовый код приглашения (только admin). Код
+// показывается один раз, в invite_codes хранится только его SHA-256; выдача
+// пишется в user_audit в той же транзакции.
+func createInvite(c *gin.Context) {
+	var req CreateInviteRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ttl := inviteTTL
+	if req.ExpiresIn != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.ExpiresIn); err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a positive duration like 72h"})
+			return
+		}
+	}
+	ctx := c.Request.Context()
+	adminID := c.GetInt("user_id")
+
+	code, err := randomID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invite"})
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	if err := insertInvite(ctx, adminID, hashToken(code), expiresAt); err != nil {
+		logging.FromContext(ctx).Error("❌ Ошибка создания приглашения", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	logging.FromContext(ctx).Info("✉️ Создан код приглашения", "admin_id", adminID, "expires_at", expiresAt)
+	c.JSON(http.StatusCreated, gin.H{"code": code, "expires_at": expiresAt})
+}
+
+// insertInvite сохраняет хеш кода приглашения и запись аудита в одной транзакции
+func insertInvite(ctx context.Context, adminID int, codeHash string, expiresAt time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inviteID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO invite_codes (code, created_by, expires_at) VALUES ($1, $2, $3)
+		RETURNING id
+	`, codeHash, adminID, expiresAt).Scan(&inviteID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(gin.H{"invite_id": inviteID, "expires_at": expiresAt})
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_audit (user_id, action, changed_by, new_data)
+		VALUES ($1, $2, $3, $4)
+	`, adminID, auditInviteCreated, adminID, string(data))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// TestParseRegistrationPolicy проверяет значения REGISTRATION_POLICY
+func TestParseRegistrationPolicy(t *testing.T) {
+	for _, value := range []string{"open", "invite", "disabled"} {
+		if policy, err := parseRegistrationPolicy(value); err != nil || policy != value {
+			t.Errorf("Policy %q should be valid, got %q %v", value, policy, err)
+		}
+	}
+	if _, err := parseRegistrationPolicy("closed"); err == nil {
+		t.Error("Unknown policy should fail")
+	}
+}
+
+// TestRegistrationPolicy проверяет, что закрытая регистрация отклоняется до БД
+func TestRegistrationPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/register", register)
+
+	register := func(body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(body)))
+		return w.Code
+	}
+	t.Cleanup(func() { registrationPolicy = registrationOpen })
+
+	registrationPolicy = registrationDisabled
+	if code := register(`{"email":"new@quotopia.com","password":"password123"}`); code != http.StatusForbidden {
+		t.Errorf("Disabled registration: expected 403, got %d", code)
+	}
+
+	registrationPolicy = registrationInvite
+	if code := register(`{"email":"new@quotopia.com","password":"password123"}`); code != http.StatusForbidden {
+		t.Errorf("Registration without invite: expected 403, got %d", code)
+	}
+	if code := register(`{"email":"new@quotopia.com","password":"short","invite_code":"abc"}`); code != http.StatusBadRequest {
+		t.Errorf("Invalid request: expected 400, got %d", code)
+	}
+	// Длина пароля считается в байтах: 40 символов кириллицы - 80 байт
+	if code := register(`{"email":"new@quotopia.com","password":"` + strings.Repeat("я", 40) + `","invite_code":"abc"}`); code != http.StatusBadRequest {
+		t.Errorf("Multibyte password over 72 bytes: expected 400, got %d", code)
+	}
+}
+
+// TestAdminCreateValidation проверяет создание пользователей и приглашений admin
+func TestAdminCreateValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/admin/users", adminCreateUser)
+	r.POST("/auth/admin/invites", createInvite)
+
+	cases := []struct {
+		path, body string
+	}{
+		{"/auth/admin/users", `{"email":"ops@quotopia.com","password":"password123","role":"root"}`},
+		{"/auth/admin/users", `{"email":"ops@quotopia.com","password":"password123"}`},
+		{"/auth/admin/users", `{"email":"ops@quotopia.com","password":"short","role":"admin"}`},
+		{"/auth/admin/users", `{"email":"ops@quotopia.com","password":"` + strings.Repeat("я", 40) + `","role":"admin"}`},
+		{"/auth/admin/invites", `{"expires_in":"soon"}`},
+		{"/auth/admin/invites", `{"expires_in":"-1h"}`},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected 400, got %d", tc.path, tc.body, w.Code)
+		}
+	}
+}
+
+// TestCreateInviteAudit проверяет, что выдача приглашения пишется в
+// user_audit в той же транзакции, а в invite_codes попадает только хеш кода
+func TestCreateInviteAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 1) })
+	r.POST("/auth/admin/invites", createInvite)
+
+	mock := mockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(quoteSQL("INSERT INTO invite_codes (code, created_by, expires_at)")).
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(quoteSQL("INSERT INTO user_audit")).
+		WithArgs(1, auditInviteCreated, 1, jsonWith(`"invite_id":7`)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	w := post(r, "/auth/admin/invites", `{"expires_in":"24h"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Code      string    `json:"code"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Code == "" {
+		t.Fatalf("Unexpected response %s: %v", w.Body, err)
+	}
+	if ttl := time.Until(resp.ExpiresAt); ttl < 23*time.Hour || ttl > 24*time.Hour {
+		t.Errorf("Unexpected expires_at %v", resp.ExpiresAt)
+	}
+
+	// Ошибка аудита откатывает и приглашение
+	mock.ExpectBegin()
+	mock.ExpectQuery(quoteSQL("INSERT INTO invite_codes")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	mock.ExpectExec(quoteSQL("INSERT INTO user_audit")).WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+	if w := post(r, "/auth/admin/invites", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("Audit failure: expected 500, got %d", w.Code)
+	}
+}
+
+// expectInviteLock ожидает блокировку кода приглашения; inviteID 0 - код
+// не найден (просрочен или использован)
+func expectInviteLock(mock sqlmock.Sqlmock, code string, inviteID int) {
+	mock.ExpectBegin()
+	rows := sqlmock.NewRows([]string{"id"})
+	if inviteID != 0 {
+		rows.AddRow(inviteID)
+	}
+	mock.ExpectQuery(quoteSQL("SELECT id FROM invite_codes")).WithArgs(hashToken(code)).WillReturnRows(rows)
+}
+
+// expectInviteRegistration ожидает регистрацию по заблокированному коду:
+// проверку email и создание пользователя
+func expectInviteRegistration(mock sqlmock.Sqlmock, email, code string, inviteID int) {
+	expectInviteLock(mock, code, inviteID)
+	mock.ExpectQuery(quoteSQL("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)")).WithArgs(email).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(quoteSQL("INSERT INTO users (email, password_hash, role, is_active)")).
+		WithArgs(email, sqlmock.AnyArg(), defaultRole, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "is_active", "created_at", "token_version"}).
+			AddRow(5, email, defaultRole, true, time.Now(), 0))
+}
+
+// TestRegisterWithInvite проверяет, что действующий код принимается и
+// гасится, а просроченный или использованный отклоняется до проверки email
+func TestRegisterWithInvite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/register", register)
+	registrationPolicy = registrationInvite
+	t.Cleanup(func() { registrationPolicy = registrationOpen })
+	body := `{"email":"new@quotopia.com","password":"password123","invite_code":"invite-1"}`
+
+	t.Run("accepted", func(t *testing.T) {
+		mock := mockDB(t)
+		expectInviteRegistration(mock, "new@quotopia.com", "invite-1", 7)
+		mock.ExpectExec(quoteSQL("UPDATE invite_codes SET used_by = $2, used_at = NOW() WHERE id = $1")).
+			WithArgs(7, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec(quoteSQL("INSERT INTO refresh_tokens")).
+			WithArgs(5, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		if w := post(r, "/auth/register", body); w.Code != http.StatusCreated {
+			t.Errorf("Expected 201, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	// Условие (used_at IS NULL AND expires_at > NOW()) не выполнено: email не
+	// проверяется, ответ не зависит от того, зарегистрирован ли он
+	t.Run("expired or used", func(t *testing.T) {
+		mock := mockDB(t)
+		expectInviteLock(mock, "invite-1", 0)
+		mock.ExpectRollback()
+
+		if w := post(r, "/auth/register", body); w.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("email taken", func(t *testing.T) {
+		mock := mockDB(t)
+		expectInviteLock(mock, "invite-1", 7)
+		mock.ExpectQuery(quoteSQL("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)")).WithArgs("new@quotopia.com").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		if w := post(r, "/auth/register", body); w.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d: %s", w.Code, w.Body)
+		}
+	})
+}
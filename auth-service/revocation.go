@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultRevocationPruneInterval как часто из хранилища удаляются отозванные токены с истёкшим сроком
+const defaultRevocationPruneInterval = 10 * time.Minute
+
+// RevocationStore хранилище отозванных access токенов (по jti). Запись нужна
+// только до истечения токена: после этого он отклоняется и без неё.
+type RevocationStore interface {
+	// Revoke отзывает токен jti, действующий до expiresAt
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsRevoked отозван ли токен
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// Prune удаляет записи истёкших токенов и возвращает их число
+	Prune(ctx context.Context) (int64, error)
+}
+
+// openRevocationStore выбирает хранилище по REVOCATION_STORE: memory или postgres
+func openRevocationStore(db *sql.DB) (RevocationStore, error) {
+	switch backend := getEnv("REVOCATION_STORE", "memory"); backend {
+	case "memory":
+		return NewMemoryRevocationStore(), nil
+	case "postgres":
+		return NewPostgresRevocationStore(db), nil
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище отзывов %q (ожидается memory или postgres)", backend)
+	}
+}
+
+// MemoryRevocationStore хранит отзывы в памяти процесса. Подходит для одного
+// экземпляра auth-service; после перезапуска отзывы теряются.
+type MemoryRevocationStore struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	revoked map[string]time.Time // jti -> срок действия токена
+}
+
+// NewMemoryRevocationStore создаёт пустое хранилище в памяти
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{now: time.Now, revoked: make(map[string]time.Time)}
+}
+
+// Revoke реализует RevocationStore
+func (m *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked реализует RevocationStore
+func (m *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+// Prune реализует RevocationStore
+func (m *MemoryRevocationStore) Prune(ctx context.Context) (int64, error) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned int64
+	for jti, expiresAt := range m.revoked {
+		if now.After(expiresAt) {
+			delete(m.revoked, jti)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// PostgresRevocationStore хранит отзывы в таблице revoked_tokens, общей для
+// всех экземпляров auth-service
+type PostgresRevocationStore struct {
+	db *sql.DB
+}
+
+// NewPostgresRevocationStore создаёт хранилище отзывов поверх пула БД
+func NewPostgresRevocationStore(db *sql.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{db: db}
+}
+
+// Revoke реализует RevocationStore
+func (p *PostgresRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := p.db.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, expiresAt)
+	return err
+}
+
+// IsRevoked реализует RevocationStore
+func (p *PostgresRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := p.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	return revoked, err
+}
+
+// Prune реализует RevocationStore
+func (p *PostgresRevocationStore) Prune(ctx context.Context) (int64, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// runRevocationPruner периодически чистит хранилище до отмены ctx
+func runRevocationPruner(ctx context.Context, store RevocationStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := store.Prune(ctx)
+			if err != nil {
+				slog.Warn("⚠️ Не удалось очистить отозванные токены", "error", err)
+				continue
+			}
+			if pruned > 0 {
+				slog.Debug("🧹 Удалены истёкшие отзывы токенов", "count", pruned)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// TestMemoryRevocationStore проверяет отзыв и очистку по сроку действия
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	store := NewMemoryRevocationStore()
+	store.now = func() time.Time { return now }
+
+	store.Revoke(ctx, "short", now.Add(time.Minute))
+	store.Revoke(ctx, "long", now.Add(time.Hour))
+	if revoked, _ := store.IsRevoked(ctx, "short"); !revoked {
+		t.Error("Revoked token should be reported")
+	}
+	if revoked, _ := store.IsRevoked(ctx, "other"); revoked {
+		t.Error("Unknown token should not be revoked")
+	}
+
+	now = now.Add(10 * time.Minute)
+	if pruned, _ := store.Prune(ctx); pruned != 1 {
+		t.Errorf("Expected 1 pruned token, got %d", pruned)
+	}
+	if revoked, _ := store.IsRevoked(ctx, "long"); !revoked {
+		t.Error("Unexpired revocation should survive pruning")
+	}
+}
+
+// TestLogoutRevokesAccessToken проверяет, что после выхода токен не принимается
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	versions := fakeTokenChecks(t)
+
+	r := gin.New()
+	r.POST("/auth/logout", authMiddleware(), logout)
+	r.GET("/auth/me", authMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	user := User{ID: 5, Email: "user@quotopia.com", Role: "user"}
+	first, _, _ := generateToken(user, "")
+	second, _, _ := generateToken(user, "")
+
+	if code := do(http.MethodPost, "/auth/logout", first); code != http.StatusOK {
+		t.Fatalf("Logout failed: %d", code)
+	}
+	if code := do(http.MethodGet, "/auth/me", first); code != http.StatusUnauthorized {
+		t.Errorf("Revoked token: expected 401, got %d", code)
+	}
+	// Другой вход того же пользователя продолжает работать
+	if code := do(http.MethodGet, "/auth/me", second); code != http.StatusOK {
+		t.Errorf("Other session: expected 200, got %d", code)
+	}
+
+	// Выход везде увеличивает версию: старые токены отклоняются, новые работают
+	versions[user.ID]++
+	if code := do(http.MethodGet, "/auth/me", second); code != http.StatusUnauthorized {
+		t.Errorf("Token of old version: expected 401, got %d", code)
+	}
+	user.TokenVersion = versions[user.ID]
+	fresh, _, _ := generateToken(user, "")
+	if code := do(http.MethodGet, "/auth/me", fresh); code != http.StatusOK {
+		t.Errorf("Token of new version: expected 200, got %d", code)
+	}
+}
+
+// TestLogoutRevokesSession проверяет, что выход без тела отзывает семейство
+// refresh токенов входа по sid access токена
+func TestLogoutRevokesSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fakeTokenChecks(t)
+	mock := mockDB(t)
+	mock.ExpectExec(quoteSQL("WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL")).
+		WithArgs("family-1", 5).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	r := gin.New()
+	r.POST("/auth/logout", authMiddleware(), logout)
+
+	token, _, _ := generateToken(User{ID: 5, Role: "user"}, "family-1")
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Типы токенов (claim typ) и их issuer. Refresh токен с typ=refresh не
+// принимается как access, даже если подписан тем же JWT_SECRET.
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+
+	accessTokenIssuer  = "quotopia-auth"
+	refreshTokenIssuer = "quotopia-auth-refresh"
+
+	accessTokenTTL  = 1 * time.Hour
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Ошибки обмена refresh токена
+var (
+	errRefreshInvalid = errors.New("refresh token is invalid or revoked")
+	errRefreshReused  = errors.New("refresh token reuse detected")
+	errUserInactive   = errors.New("user is inactive")
+	errTokenRevoked   = errors.New("token is revoked")
+)
+
+// userTokenState текущая версия токенов пользователя и отозвано ли семейство
+// refresh токенов входа sessionID. "Выйти везде" увеличивает версию, и все
+// выданные раньше access токены перестают приниматься; отзыв семейства (выход,
+// повторное предъявление refresh токена) - access токены этого входа.
+var userTokenState = func(ctx context.Context, userID int, sessionID string) (version int, sessionRevoked bool, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT token_version, EXISTS(
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = $2 AND user_id = $1 AND revoked_at IS NOT NULL
+		)
+		FROM users WHERE id = $1
+	`, userID, sessionID).Scan(&version, &sessionRevoked)
+	return version, sessionRevoked, err
+}
+
+// execer общий интерфейс *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// generateToken генерация access токена. jti позволяет отозвать токен при выходе,
+// ver - все токены пользователя разом, sid - семейство refresh токенов входа.
+func generateToken(user User, sessionID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(accessTokenTTL)
+	jti, err := randomID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := JWTClaims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		Type:      accessTokenType,
+		Version:   user.TokenVersion,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    accessTokenIssuer,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	tokensIssued.WithLabelValues("access").Inc()
+	return tokenString, expiresAt, nil
+}
+
+// generateRefreshToken генерация refresh токена. Уникальный jti гарантирует,
+// что два токена, выданных в одну секунду, различаются (и их хеши тоже).
+func generateRefreshToken(user User) (string, time.Time, error) {
+	expiresAt := time.Now().Add(refreshTokenTTL)
+	jti, err := randomID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := JWTClaims{
+		UserID: user.ID,
+		Type:   refreshTokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    refreshTokenIssuer,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// parseToken проверяет подпись, срок действия, issuer и тип токена
+func parseToken(tokenString, tokenType string) (*JWTClaims, error) {
+	issuer := accessTokenIssuer
+	if tokenType == refreshTokenType {
+		issuer = refreshTokenIssuer
+	}
+
+	claims := &JWTClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (any, error) {
+		return jwtSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("token type %q, expected %q", claims.Type, tokenType)
+	}
+	return claims, nil
+}
+
+// checkAccessToken проверяет, что access токен не отозван выходом, сменой
+// версии или отзывом семейства refresh токенов его входа
+func checkAccessToken(ctx context.Context, claims *JWTClaims) error {
+	if claims.ID == "" {
+		return errTokenRevoked
+	}
+	revoked, err := revocations.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return errTokenRevoked
+	}
+
+	version, sessionRevoked, err := userTokenState(ctx, claims.UserID, claims.SessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if version != claims.Version || sessionRevoked {
+		return errTokenRevoked
+	}
+	return nil
+}
+
+// issueTokens выдаёт пару токенов нового входа: refresh токен начинает
+// семейство, access токен несёт его в sid
+func issueTokens(ctx context.Context, q execer, user User) (TokenResponse, error) {
+	familyID, err := randomID()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	token, expiresAt, err := generateToken(user, familyID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	refreshToken, err := issueRefreshToken(ctx, q, user, familyID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	return TokenResponse{Token: token, RefreshToken: refreshToken, ExpiresAt: expiresAt, User: user}, nil
+}
+
+// issueRefreshToken выдаёт refresh токен семейства familyID и сохраняет его хеш.
+// При обмене передаётся семейство старого токена.
+func issueRefreshToken(ctx context.Context, q execer, user User, familyID string) (string, error) {
+	token, expiresAt, err := generateRefreshToken(user)
+	if err != nil {
+		return "", err
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, token, family_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, hashToken(token), familyID, expiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	tokensIssued.WithLabelValues("refresh").Inc()
+	return token, nil
+}
+
+// rotateRefreshToken обменивает refresh токен на новый из того же семейства
+// и возвращает семейство для sid нового access токена. Каждый токен
+// обменивается один раз: повторное предъявление означает, что токен украден
+// (или уже украден новый), и отзывается всё семейство.
+func rotateRefreshToken(ctx context.Context, token string) (user User, next, familyID string, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return user, "", "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, userID        int
+		usedAt, revokedAt *time.Time
+	)
+	// FOR UPDATE: два одновременных обмена одного токена не выдадут два новых
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, used_at, revoked_at
+		FROM refresh_tokens WHERE token = $1
+		FOR UPDATE
+	`, hashToken(token)).Scan(&id, &userID, &familyID, &usedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, "", "", errRefreshInvalid
+	}
+	if err != nil {
+		return user, "", "", err
+	}
+	if revokedAt != nil {
+		return user, "", "", errRefreshInvalid
+	}
+	if usedAt != nil {
+		if err := revokeFamily(ctx, tx, familyID); err != nil {
+			return user, "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return user, "", "", err
+		}
+		return user, "", "", errRefreshReused
+	}
+
+	// Роль и активность берём из БД: они могли измениться после входа.
+	// FOR SHARE: "выйти везде" дождётся обмена и отзовёт и новый токен
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, email, role, is_active, created_at, last_login, token_version
+		FROM users WHERE id = $1
+		FOR SHARE
+	`, userID).Scan(&user.ID, &user.Email, &user.Role, &user.IsActive, &user.CreatedAt, &user.LastLogin, &user.TokenVersion)
+	if err != nil {
+		return user, "", "", err
+	}
+	if !user.IsActive {
+		if err := revokeFamily(ctx, tx, familyID); err != nil {
+			return user, "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return user, "", "", err
+		}
+		return user, "", "", errUserInactive
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1", id); err != nil {
+		return user, "", "", err
+	}
+	next, err = issueRefreshToken(ctx, tx, user, familyID)
+	if err != nil {
+		return user, "", "", err
+	}
+	return user, next, familyID, tx.Commit()
+}
+
+// revokeRefreshToken отзывает семейство refresh токена пользователя (выход с
+// одного устройства); чужой или неизвестный токен игнорируется
+func revokeRefreshToken(ctx context.Context, token string, userID int) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = $1 AND user_id = $2)
+		  AND revoked_at IS NULL
+	`, hashToken(token), userID)
+	return err
+}
+
+// revokeSession отзывает семейство refresh токенов входа (sid access токена)
+func revokeSession(ctx context.Context, familyID string, userID int) error {
+	_, err := db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, familyID, userID)
+	return err
+}
+
+// revokeAllTokens увеличивает версию токенов пользователя и отзывает все его
+// refresh токены (выход на всех устройствах)
+func revokeAllTokens(ctx context.Context, userID int) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeUserTokens то же, что revokeAllTokens, внутри транзакции вызывающего
+// (смена и сброс пароля)
+func revokeUserTokens(ctx context.Context, q execer, userID int) error {
+	if _, err := q.ExecContext(ctx, "UPDATE users SET token_version = token_version + 1 WHERE id = $1", userID); err != nil {
+		return err
+	}
+	_, err := q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`, userID)
+	return err
+}
+
+// revokeFamily отзывает все ещё действующие токены семейства
+func revokeFamily(ctx context.Context, q execer, familyID string) error {
+	_, err := q.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`, familyID)
+	return err
+}
+
+// hashToken SHA-256 токена: в БД хранится только хеш, утечка таблицы не даёт
+// действующих токенов. bcrypt не нужен - токен случайный и длинный.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomID случайный идентификатор из 128 бит (jti, семейство токенов)
+func randomID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
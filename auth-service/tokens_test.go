@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// mockDB подменяет db на sqlmock; в конце теста проверяет, что все ожидаемые
+// запросы выполнены
+func mockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := db
+	db = conn
+	t.Cleanup(func() {
+		db = prev
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		conn.Close()
+	})
+	return mock
+}
+
+// quoteSQL экранирует текст запроса для сравнения в sqlmock
+func quoteSQL(query string) string {
+	return regexp.QuoteMeta(query)
+}
+
+// fakeTokenChecks подменяет хранилище отзывов и версии токенов на память;
+// возвращает карту версий пользователей
+func fakeTokenChecks(t *testing.T) map[int]int {
+	versions := map[int]int{}
+	prevRevocations, prevState := revocations, userTokenState
+	revocations = NewMemoryRevocationStore()
+	userTokenState = func(ctx context.Context, userID int, sessionID string) (int, bool, error) {
+		return versions[userID], false, nil
+	}
+	t.Cleanup(func() { revocations, userTokenState = prevRevocations, prevState })
+	return versions
+}
+
+// TestTokenTypes проверяет, что access и refresh токены не взаимозаменяемы
+func TestTokenTypes(t *testing.T) {
+	user := User{ID: 1, Email: "trader@quotopia.com", Role: "trader"}
+
+	access, _, err := generateToken(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, _, err := generateRefreshToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims, err := parseToken(access, accessTokenType); err != nil || claims.Role != "trader" {
+		t.Errorf("Access token should be valid: %v", err)
+	}
+	if _, err := parseToken(refresh, refreshTokenType); err != nil {
+		t.Errorf("Refresh token should be valid: %v", err)
+	}
+	if _, err := parseToken(refresh, accessTokenType); err == nil {
+		t.Error("Refresh token should not be accepted as access token")
+	}
+	if _, err := parseToken(access, refreshTokenType); err == nil {
+		t.Error("Access token should not be accepted as refresh token")
+	}
+}
+
+// TestRefreshTokensUnique проверяет, что токены одного пользователя различаются
+func TestRefreshTokensUnique(t *testing.T) {
+	user := User{ID: 1}
+	first, _, _ := generateRefreshToken(user)
+	second, _, _ := generateRefreshToken(user)
+	if first == second || hashToken(first) == hashToken(second) {
+		t.Error("Refresh tokens issued together should differ")
+	}
+	if hashToken(first) != hashToken(first) || len(hashToken(first)) != 64 {
+		t.Error("Token hash should be a stable SHA-256 hex")
+	}
+}
+
+// TestAuthMiddlewareRejectsRefreshToken проверяет защищённые endpoints
+func TestAuthMiddlewareRejectsRefreshToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fakeTokenChecks(t)
+	r := gin.New()
+	r.GET("/auth/me", authMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetInt("user_id")})
+	})
+
+	user := User{ID: 1, Email: "user@quotopia.com", Role: "user"}
+	access, _, _ := generateToken(user, "")
+	refresh, _, _ := generateRefreshToken(user)
+
+	for token, want := range map[string]int{access: http.StatusOK, refresh: http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Expected %d, got %d", want, w.Code)
+		}
+	}
+}
+
+// TestRefreshRejectsAccessToken проверяет, что /auth/refresh не принимает access токен
+func TestRefreshRejectsAccessToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/refresh", refreshToken)
+
+	access, _, _ := generateToken(User{ID: 1}, "")
+	for body, want := range map[string]int{
+		`{}`:                                  http.StatusBadRequest,
+		`{"refresh_token":"` + access + `"}`:  http.StatusUnauthorized,
+		`{"refresh_token":"not-a-jwt-token"}`: http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/refresh", strings.NewReader(body)))
+		if w.Code != want {
+			t.Errorf("Body %s: expected %d, got %d", body, want, w.Code)
+		}
+	}
+}
+
+// expectRefreshLookup ожидает начало обмена: блокировку записи refresh токена
+func expectRefreshLookup(mock sqlmock.Sqlmock, token string, usedAt, revokedAt *time.Time) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(quoteSQL("FROM refresh_tokens WHERE token = $1")).
+		WithArgs(hashToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id", "used_at", "revoked_at"}).
+			AddRow(10, 1, "family-1", usedAt, revokedAt))
+}
+
+// expectUserForShare ожидает чтение пользователя при обмене
+func expectUserForShare(mock sqlmock.Sqlmock, active bool) {
+	mock.ExpectQuery(quoteSQL("FROM users WHERE id = $1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role", "is_active", "created_at", "last_login", "token_version"}).
+			AddRow(1, "trader@quotopia.com", "trader", active, time.Now(), nil, 3))
+}
+
+func postRefresh(t *testing.T, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/auth/refresh", refreshToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/refresh",
+		strings.NewReader(`{"refresh_token":"`+token+`"}`)))
+	return w
+}
+
+// TestRefreshRotation проверяет обмен: старый токен помечается использованным,
+// новый выдаётся в том же семействе, access токен - с текущей версией из БД
+func TestRefreshRotation(t *testing.T) {
+	mock := mockDB(t)
+	old, _, _ := generateRefreshToken(User{ID: 1})
+
+	expectRefreshLookup(mock, old, nil, nil)
+	expectUserForShare(mock, true)
+	mock.ExpectExec(quoteSQL("UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1")).
+		WithArgs(10).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(quoteSQL("INSERT INTO refresh_tokens (user_id, token, family_id, expires_at)")).
+		WithArgs(1, sqlmock.AnyArg(), "family-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(11, 1))
+	mock.ExpectCommit()
+
+	w := postRefresh(t, old)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp TokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.RefreshToken == "" || resp.RefreshToken == old {
+		t.Error("Refresh should return a new refresh token")
+	}
+	claims, err := parseToken(resp.Token, accessTokenType)
+	if err != nil || claims.Role != "trader" || claims.Version != 3 {
+		t.Errorf("Access token should carry role and version from DB: %+v %v", claims, err)
+	}
+	if claims != nil && claims.SessionID != "family-1" {
+		t.Errorf("Access token sid should be the refresh family, got %q", claims.SessionID)
+	}
+}
+
+// TestRefreshReuseRevokesFamily проверяет, что повторное предъявление уже
+// обменянного токена отзывает всё семейство
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	mock := mockDB(t)
+	old, _, _ := generateRefreshToken(User{ID: 1})
+	used := time.Now().Add(-time.Minute)
+
+	expectRefreshLookup(mock, old, &used, nil)
+	mock.ExpectExec(quoteSQL("UPDATE refresh_tokens SET revoked_at = NOW()")).
+		WithArgs("family-1").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	w := postRefresh(t, old)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "reuse") {
+		t.Errorf("Expected 401 reuse detected, got %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestReuseRevokesSessionAccessTokens проверяет, что после обнаружения повторного
+// обмена access токены этого входа (sid семейства) не принимаются, а других - да
+func TestReuseRevokesSessionAccessTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mock := mockDB(t)
+	prevRevocations := revocations
+	revocations = NewMemoryRevocationStore()
+	t.Cleanup(func() { revocations = prevRevocations })
+
+	user := User{ID: 1, Email: "trader@quotopia.com", Role: "trader", TokenVersion: 3}
+	stolen, _, _ := generateToken(user, "family-1")
+	other, _, _ := generateToken(user, "family-2")
+	old, _, _ := generateRefreshToken(user)
+	used := time.Now().Add(-time.Minute)
+
+	expectRefreshLookup(mock, old, &used, nil)
+	mock.ExpectExec(quoteSQL("UPDATE refresh_tokens SET revoked_at = NOW()")).
+		WithArgs("family-1").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	if w := postRefresh(t, old); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected reuse detection, got %d", w.Code)
+	}
+
+	r := gin.New()
+	r.GET("/auth/me", authMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	for _, tc := range []struct {
+		token, family string
+		revoked       bool
+		want          int
+	}{
+		{stolen, "family-1", true, http.StatusUnauthorized},
+		{other, "family-2", false, http.StatusOK},
+	} {
+		mock.ExpectQuery(quoteSQL("SELECT token_version, EXISTS(")).WithArgs(1, tc.family).
+			WillReturnRows(sqlmock.NewRows([]string{"token_version", "exists"}).AddRow(3, tc.revoked))
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("Access token of %s: expected %d, got %d", tc.family, tc.want, w.Code)
+		}
+	}
+}
+
+// TestRefreshRevokedOrInactive проверяет отозванный токен и заблокированного пользователя
+func TestRefreshRevokedOrInactive(t *testing.T) {
+	t.Run("revoked", func(t *testing.T) {
+		mock := mockDB(t)
+		old, _, _ := generateRefreshToken(User{ID: 1})
+		revoked := time.Now()
+
+		expectRefreshLookup(mock, old, nil, &revoked)
+		mock.ExpectRollback()
+
+		if w := postRefresh(t, old); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("inactive", func(t *testing.T) {
+		mock := mockDB(t)
+		old, _, _ := generateRefreshToken(User{ID: 1})
+
+		expectRefreshLookup(mock, old, nil, nil)
+		expectUserForShare(mock, false)
+		mock.ExpectExec(quoteSQL("UPDATE refresh_tokens SET revoked_at = NOW()")).
+			WithArgs("family-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if w := postRefresh(t, old); w.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"ft-mt/candles"
+	"ft-mt/internal/logging"
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxCandleHistory сколько закрытых свечей хранится на символ и интервал
+const maxCandleHistory = 500
+
+// aggregateCandles собирает свечи по всем тикам общего движка. Подписка
+// внутренняя: политика медленных подписчиков не останавливает агрегацию.
+func (s *QuoteServer) aggregateCandles(ctx context.Context) {
+	sub := s.hub.SubscribeInternal()
+	defer s.hub.Unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case quote, ok := <-sub.C:
+			if !ok {
+				if !sub.Finished() {
+					slog.Warn("⚠️ Агрегатор свечей отключён от хаба")
+				}
+				return
+			}
+			s.candles.Add(quote.Symbol, quote.Price, quote.LastSize, time.UnixMilli(quote.Timestamp))
+		}
+	}
+}
+
+// StreamCandles стримит свечи инструмента: сначала history закрытых свечей,
+// затем текущую и обновления на каждом тике. Закрытая свеча отправляется
+// с closed=true в момент, когда первый тик открывает следующий интервал.
+func (s *QuoteServer) StreamCandles(req *pb.CandleRequest, stream pb.QuoteService_StreamCandlesServer) error {
+	shared, ok := s.candles.Aggregator(req.Interval)
+	if !ok {
+		return status.Errorf(codes.InvalidArgument, "unsupported interval %q (expected one of %v)",
+			req.Interval, candles.IntervalNames())
+	}
+	if err := s.validateSymbol(req.Symbol); err != nil {
+		return err
+	}
+	if req.History < 0 || req.History > maxCandleHistory {
+		return status.Errorf(codes.InvalidArgument, "history must be between 0 and %d", maxCandleHistory)
+	}
+
+	logger := logging.FromContext(stream.Context())
+	logger.Info("Новое подключение к свечам", "symbol", req.Symbol, "interval", req.Interval)
+
+	// Подписываемся до снимка: тики, уже учтённые в снимке, локальный агрегатор пропустит
+	sub := s.hub.Subscribe([]string{req.Symbol})
+	defer s.hub.Unsubscribe(sub)
+
+	history, current := shared.Snapshot(req.Symbol, int(req.History))
+	snapshot := len(history)
+	if current != nil {
+		snapshot++
+	}
+	if err := stream.SendHeader(metadata.Pairs(pb.CandleSnapshotHeader, strconv.Itoa(snapshot))); err != nil {
+		return err
+	}
+	for _, candle := range history {
+		if err := stream.Send(candleToProto(candle)); err != nil {
+			return err
+		}
+	}
+
+	local, _ := candles.NewAggregator(req.Interval, 0)
+	if current != nil {
+		local.Restore(*current)
+		if err := stream.Send(candleToProto(*current)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.shutdown:
+			return errShuttingDown
+		case quote, ok := <-sub.C:
+			if !ok {
+				if sub.Slow() {
+					return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+				}
+				if sub.Finished() {
+					return errReplayFinished
+				}
+				return status.Error(codes.Unavailable, "candle stream closed")
+			}
+
+			closed, candle, ok := local.Add(quote.Symbol, quote.Price, quote.LastSize, time.UnixMilli(quote.Timestamp))
+			if !ok {
+				continue
+			}
+			if closed != nil {
+				if err := stream.Send(candleToProto(*closed)); err != nil {
+					return err
+				}
+			}
+			if err := stream.Send(candleToProto(candle)); err != nil {
+				logger.Warn("Ошибка отправки свечи", "error", err)
+				return err
+			}
+		}
+	}
+}
+
+// candleToProto конвертирует свечу агрегатора в protobuf
+func candleToProto(candle candles.Candle) *pb.Candle {
+	return &pb.Candle{
+		Symbol:    candle.Symbol,
+		Interval:  candle.Interval,
+		OpenTime:  candle.OpenTime.UnixMilli(),
+		CloseTime: candle.CloseTime.UnixMilli(),
+		Open:      candle.Open,
+		High:      candle.High,
+		Low:       candle.Low,
+		Close:     candle.Close,
+		Volume:    candle.Volume,
+		Closed:    candle.Closed,
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeCandleStream серверный стрим свечей для тестов
+type fakeCandleStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	sent   chan *pb.Candle
+	header metadata.MD
+}
+
+func (f *fakeCandleStream) Context() context.Context { return f.ctx }
+
+func (f *fakeCandleStream) SendHeader(md metadata.MD) error {
+	f.header = md
+	return nil
+}
+
+func (f *fakeCandleStream) Send(candle *pb.Candle) error {
+	f.sent <- candle
+	return nil
+}
+
+// TestStreamCandles проверяет историю, текущую свечу и закрытие интервала
+func TestStreamCandles(t *testing.T) {
+	clock := newFakeClock()
+	server := newTestQuoteServer(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Два тика попадают в общий агрегатор до подключения клиента
+	start := clock.Now()
+	for i := 1; i <= 2; i++ {
+		for _, quote := range server.engine.tick(start.Add(time.Duration(i) * time.Second)) {
+			server.candles.Add(quote.Symbol, quote.Price, quote.LastSize, time.UnixMilli(quote.Timestamp))
+		}
+	}
+
+	stream := &fakeCandleStream{ctx: ctx, sent: make(chan *pb.Candle, 10)}
+	go server.StreamCandles(&pb.CandleRequest{Symbol: "BTC", Interval: "1s", History: 5}, stream)
+
+	closed, current := <-stream.sent, <-stream.sent
+	if got := stream.header.Get(pb.CandleSnapshotHeader); len(got) != 1 || got[0] != "2" {
+		t.Errorf("Заголовок снимка должен быть 2 (история + текущая), получено %v", got)
+	}
+	if !closed.Closed || closed.OpenTime != start.Add(time.Second).UnixMilli() {
+		t.Errorf("Первой должна прийти закрытая свеча за первую секунду, получено %v", closed)
+	}
+	if current.Closed || current.OpenTime != start.Add(2*time.Second).UnixMilli() {
+		t.Errorf("Второй должна прийти текущая свеча, получено %v", current)
+	}
+
+	// Следующий тик закрывает текущую свечу и открывает новую
+	for server.hub.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, quote := range server.engine.tick(start.Add(3 * time.Second)) {
+		server.hub.Publish(quote)
+	}
+	rolled, next := <-stream.sent, <-stream.sent
+	if !rolled.Closed || rolled.OpenTime != current.OpenTime || rolled.Close != current.Close {
+		t.Errorf("Ожидалось закрытие текущей свечи, получено %v", rolled)
+	}
+	if next.Closed || next.OpenTime != start.Add(3*time.Second).UnixMilli() {
+		t.Errorf("Ожидалась новая текущая свеча, получено %v", next)
+	}
+}
+
+// TestStreamCandlesValidation проверяет отказ для неверного интервала и символа
+func TestStreamCandlesValidation(t *testing.T) {
+	server := NewQuoteServer()
+	stream := &fakeCandleStream{ctx: context.Background(), sent: make(chan *pb.Candle, 1)}
+
+	requests := []*pb.CandleRequest{
+		{Symbol: "BTC", Interval: "2m"},
+		{Symbol: "UNKNOWN", Interval: "1m"},
+		{Symbol: "BTC", Interval: "1m", History: 1000},
+	}
+	for _, req := range requests {
+		if err := server.StreamCandles(req, stream); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: ожидался InvalidArgument, получено %v", req, err)
+		}
+	}
+}
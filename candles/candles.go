@@ -0,0 +1,182 @@
+// Package candles собирает тики в OHLCV-свечи на фиксированных интервалах.
+package candles
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Intervals поддерживаемые интервалы свечей
+var Intervals = map[string]time.Duration{
+	"1s": time.Second,
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// IntervalNames возвращает названия интервалов по возрастанию длительности
+func IntervalNames() []string {
+	names := make([]string, 0, len(Intervals))
+	for name := range Intervals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return Intervals[names[i]] < Intervals[names[j]] })
+	return names
+}
+
+// Candle OHLCV-свеча одного символа
+type Candle struct {
+	Symbol    string
+	Interval  string
+	OpenTime  time.Time // Начало интервала (включительно)
+	CloseTime time.Time // Конец интервала (не включительно)
+	Open      float64
+	High      float64
+	Low       float64
+	Close     float64
+	Volume    float64
+	Closed    bool      // true - интервал завершён, свеча больше не меняется
+	Updated   time.Time // Время последнего учтённого тика
+}
+
+// Aggregator собирает свечи одного интервала по всем символам и хранит
+// последние keep закрытых свечей каждого символа
+type Aggregator struct {
+	mu       sync.Mutex
+	name     string
+	interval time.Duration
+	keep     int
+	current  map[string]*Candle
+	closed   map[string][]Candle
+}
+
+// NewAggregator создаёт агрегатор для интервала из Intervals
+func NewAggregator(name string, keep int) (*Aggregator, error) {
+	interval, ok := Intervals[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interval %q", name)
+	}
+	return &Aggregator{
+		name:     name,
+		interval: interval,
+		keep:     keep,
+		current:  make(map[string]*Candle),
+		closed:   make(map[string][]Candle),
+	}, nil
+}
+
+// Add учитывает тик. Возвращает свечу, закрытую этим тиком (если тик открыл
+// новый интервал), и текущую свечу. Тики не новее уже учтённых игнорируются
+// (ok = false), поэтому агрегатор можно безопасно продолжить со снимка.
+func (a *Aggregator) Add(symbol string, price, size float64, ts time.Time) (closed *Candle, current Candle, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	openTime := ts.Truncate(a.interval)
+	candle := a.current[symbol]
+	if candle != nil && !ts.After(candle.Updated) {
+		return nil, Candle{}, false
+	}
+
+	if candle != nil && !openTime.Equal(candle.OpenTime) {
+		done := *candle
+		done.Closed = true
+		closed = &done
+		a.remember(done)
+		candle = nil
+	}
+
+	if candle == nil {
+		candle = &Candle{
+			Symbol:    symbol,
+			Interval:  a.name,
+			OpenTime:  openTime,
+			CloseTime: openTime.Add(a.interval),
+			Open:      price,
+			High:      price,
+			Low:       price,
+		}
+		a.current[symbol] = candle
+	}
+
+	candle.High = max(candle.High, price)
+	candle.Low = min(candle.Low, price)
+	candle.Close = price
+	candle.Volume += size
+	candle.Updated = ts
+	return closed, *candle, true
+}
+
+// remember сохраняет закрытую свечу, ограничивая историю keep свечами
+func (a *Aggregator) remember(candle Candle) {
+	if a.keep <= 0 {
+		return
+	}
+	history := append(a.closed[candle.Symbol], candle)
+	if len(history) > a.keep {
+		history = history[len(history)-a.keep:]
+	}
+	a.closed[candle.Symbol] = history
+}
+
+// Snapshot возвращает до limit последних закрытых свечей (от старых к новым)
+// и текущую свечу символа, если она есть
+func (a *Aggregator) Snapshot(symbol string, limit int) ([]Candle, *Candle) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	history := a.closed[symbol]
+	if limit < len(history) {
+		history = history[len(history)-max(limit, 0):]
+	}
+	result := append([]Candle(nil), history...)
+
+	if candle := a.current[symbol]; candle != nil {
+		current := *candle
+		return result, &current
+	}
+	return result, nil
+}
+
+// Restore продолжает агрегацию с переданной текущей свечи
+func (a *Aggregator) Restore(candle Candle) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.current[candle.Symbol] = &candle
+}
+
+// Name возвращает название интервала
+func (a *Aggregator) Name() string {
+	return a.name
+}
+
+// Store набор агрегаторов по всем поддерживаемым интервалам
+type Store struct {
+	aggregators map[string]*Aggregator
+}
+
+// NewStore создаёт агрегаторы для всех интервалов с историей keep свечей
+func NewStore(keep int) *Store {
+	s := &Store{aggregators: make(map[string]*Aggregator, len(Intervals))}
+	for name := range Intervals {
+		s.aggregators[name], _ = NewAggregator(name, keep)
+	}
+	return s
+}
+
+// Add учитывает тик во всех интервалах
+func (s *Store) Add(symbol string, price, size float64, ts time.Time) {
+	for _, aggregator := range s.aggregators {
+		aggregator.Add(symbol, price, size, ts)
+	}
+}
+
+// Aggregator возвращает агрегатор интервала
+func (s *Store) Aggregator(interval string) (*Aggregator, bool) {
+	aggregator, ok := s.aggregators[interval]
+	return aggregator, ok
+}
@@ -0,0 +1,95 @@
+package candles
+
+import (
+	"testing"
+	"time"
+)
+
+var base = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+// TestAggregatorOHLCV проверяет open/high/low/close/volume внутри интервала
+func TestAggregatorOHLCV(t *testing.T) {
+	agg, err := NewAggregator("1m", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices := []float64{100, 105, 95, 101}
+	var current Candle
+	for i, price := range prices {
+		_, current, _ = agg.Add("BTC", price, 2, base.Add(time.Duration(i)*time.Second))
+	}
+
+	want := Candle{Open: 100, High: 105, Low: 95, Close: 101, Volume: 8}
+	if current.Open != want.Open || current.High != want.High || current.Low != want.Low ||
+		current.Close != want.Close || current.Volume != want.Volume {
+		t.Errorf("Ожидалась свеча %+v, получено %+v", want, current)
+	}
+	if !current.OpenTime.Equal(base) || !current.CloseTime.Equal(base.Add(time.Minute)) || current.Closed {
+		t.Errorf("Неверные границы или статус свечи: %+v", current)
+	}
+}
+
+// TestAggregatorRollover проверяет закрытие свечи при переходе в новый интервал
+func TestAggregatorRollover(t *testing.T) {
+	agg, _ := NewAggregator("5m", 10)
+
+	agg.Add("ETH", 10, 1, base.Add(time.Minute))
+	closed, current, _ := agg.Add("ETH", 12, 1, base.Add(5*time.Minute))
+
+	if closed == nil || !closed.Closed || closed.Close != 10 {
+		t.Fatalf("Ожидалась закрытая свеча с close=10, получено %+v", closed)
+	}
+	if current.Open != 12 || !current.OpenTime.Equal(base.Add(5*time.Minute)) {
+		t.Errorf("Новая свеча должна открыться по цене 12, получено %+v", current)
+	}
+
+	history, snapshot := agg.Snapshot("ETH", 100)
+	if len(history) != 1 || snapshot == nil || snapshot.Open != 12 {
+		t.Errorf("Неверный снимок: история %d, текущая %+v", len(history), snapshot)
+	}
+}
+
+// TestAggregatorIgnoresStaleTicks проверяет, что тики не новее учтённых пропускаются
+func TestAggregatorIgnoresStaleTicks(t *testing.T) {
+	agg, _ := NewAggregator("1m", 0)
+	agg.Add("SBER", 100, 1, base.Add(2*time.Second))
+
+	if _, _, ok := agg.Add("SBER", 200, 1, base.Add(2*time.Second)); ok {
+		t.Error("Повторный тик с тем же временем должен быть пропущен")
+	}
+	_, current, ok := agg.Add("SBER", 101, 1, base.Add(3*time.Second))
+	if !ok || current.Volume != 2 || current.High != 101 {
+		t.Errorf("Ожидалась свеча с объёмом 2 и high=101, получено %+v", current)
+	}
+}
+
+// TestAggregatorKeepsHistory проверяет ограничение истории закрытых свечей
+func TestAggregatorKeepsHistory(t *testing.T) {
+	agg, _ := NewAggregator("1s", 3)
+	for i := 0; i < 10; i++ {
+		agg.Add("BTC", float64(i), 1, base.Add(time.Duration(i)*time.Second))
+	}
+
+	history, _ := agg.Snapshot("BTC", 100)
+	if len(history) != 3 || history[0].Open != 6 || history[2].Open != 8 {
+		t.Errorf("Ожидались 3 последние закрытые свечи (6..8), получено %+v", history)
+	}
+	if limited, _ := agg.Snapshot("BTC", 1); len(limited) != 1 || limited[0].Open != 8 {
+		t.Errorf("Ожидалась одна последняя свеча, получено %+v", limited)
+	}
+}
+
+// TestIntervals проверяет список интервалов и отказ для неизвестного
+func TestIntervals(t *testing.T) {
+	names := IntervalNames()
+	want := []string{"1s", "1m", "5m", "1h", "1d"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("Ожидались интервалы %v, получено %v", want, names)
+		}
+	}
+	if _, err := NewAggregator("2m", 0); err == nil {
+		t.Error("Интервал 2m не поддерживается")
+	}
+}
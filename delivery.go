@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultMinQuoteInterval минимальный interval_ms, который сервер принимает
+const defaultMinQuoteInterval = 100 * time.Millisecond
+
+// deliveryInterval проверяет interval_ms и режим доставки запроса
+func (s *QuoteServer) deliveryInterval(req *pb.QuoteRequest) (time.Duration, error) {
+	switch req.Mode {
+	case pb.DeliveryMode_FULL_TICK, pb.DeliveryMode_CONFLATED:
+	default:
+		return 0, status.Errorf(codes.InvalidArgument, "unknown delivery mode %d", req.Mode)
+	}
+	if req.IntervalMs < 0 {
+		return 0, status.Error(codes.InvalidArgument, "interval_ms must not be negative")
+	}
+
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if interval == 0 {
+		if req.Mode == pb.DeliveryMode_CONFLATED {
+			return 0, status.Error(codes.InvalidArgument, "interval_ms is required for CONFLATED mode")
+		}
+		return 0, nil
+	}
+	if interval < s.minInterval {
+		return 0, status.Errorf(codes.InvalidArgument, "interval_ms must be at least %d", s.minInterval.Milliseconds())
+	}
+	return interval, nil
+}
+
+// deliver пересылает котировки подписчика в send. При interval = 0 каждая
+// котировка уходит сразу; иначе котировки копятся и отправляются раз в
+// interval: все подряд (FULL_TICK) или последняя по каждому символу (CONFLATED).
+func (s *QuoteServer) deliver(ctx context.Context, sub *Subscriber, interval time.Duration, mode pb.DeliveryMode, send func(*pb.Quote) error) error {
+	closed := func() error {
+		if sub.Slow() {
+			return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+		}
+		if sub.Finished() {
+			return errReplayFinished
+		}
+		return status.Error(codes.Unavailable, "quote stream closed")
+	}
+
+	if interval == 0 {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.shutdown:
+				return errShuttingDown
+			case quote, ok := <-sub.C:
+				if !ok {
+					return closed()
+				}
+				if err := send(quote); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	ticker := s.engine.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pending []*pb.Quote
+	latest := make(map[string]*pb.Quote)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.shutdown:
+			return errShuttingDown
+		case quote, ok := <-sub.C:
+			if !ok {
+				// Конец записи: отдаём накопленное за неполный интервал
+				if sub.Finished() {
+					if mode == pb.DeliveryMode_CONFLATED {
+						pending = conflated(latest)
+					}
+					for _, quote := range pending {
+						if err := send(quote); err != nil {
+							return err
+						}
+					}
+				}
+				return closed()
+			}
+			if mode == pb.DeliveryMode_CONFLATED {
+				latest[quote.Symbol] = quote
+			} else {
+				pending = append(pending, quote)
+			}
+		case <-ticker.C():
+			if mode == pb.DeliveryMode_CONFLATED {
+				pending = conflated(latest)
+				clear(latest)
+			}
+			for _, quote := range pending {
+				if err := send(quote); err != nil {
+					return err
+				}
+			}
+			pending = pending[:0]
+		}
+	}
+}
+
+// conflated последние котировки символов по алфавиту
+func conflated(latest map[string]*pb.Quote) []*pb.Quote {
+	quotes := make([]*pb.Quote, 0, len(latest))
+	for _, quote := range latest {
+		quotes = append(quotes, quote)
+	}
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Symbol < quotes[j].Symbol })
+	return quotes
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startThrottledStream запускает StreamQuotes без движка: котировки публикуются
+// тестом вручную, а доставка ждёт тикер на fake-часах
+func startThrottledStream(t *testing.T, req *pb.QuoteRequest) (*QuoteServer, *fakeClock, *fakeQuoteStream, *Subscriber) {
+	t.Helper()
+	clock := newFakeClock()
+	server := newTestQuoteServer(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	stream := newFakeQuoteStream(ctx)
+	go server.StreamQuotes(req, stream)
+	clock.WaitForTickers(t, 1)
+
+	server.hub.mu.Lock()
+	defer server.hub.mu.Unlock()
+	for sub := range server.hub.subscribers {
+		return server, clock, stream, sub
+	}
+	t.Fatal("Подписчик не зарегистрирован")
+	return nil, nil, nil, nil
+}
+
+// publish публикует котировки и ждёт, пока подписчик их вычитает
+func publish(server *QuoteServer, sub *Subscriber, quotes ...*pb.Quote) {
+	for _, quote := range quotes {
+		server.hub.Publish(quote)
+	}
+	for len(sub.C) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestStreamQuotesConflated проверяет, что за интервал приходит только последняя цена символа
+func TestStreamQuotesConflated(t *testing.T) {
+	server, clock, stream, sub := startThrottledStream(t, &pb.QuoteRequest{
+		Symbols:    []string{"BTC", "ETH"},
+		IntervalMs: 1000,
+		Mode:       pb.DeliveryMode_CONFLATED,
+	})
+
+	publish(server, sub,
+		&pb.Quote{Symbol: "ETH", Price: 1},
+		&pb.Quote{Symbol: "BTC", Price: 2},
+		&pb.Quote{Symbol: "ETH", Price: 3},
+	)
+	if len(stream.sent) != 0 {
+		t.Fatal("До конца интервала котировки не должны отправляться")
+	}
+	clock.Advance(time.Second)
+	quotes := stream.receive(t, 2)
+	if quotes[0].Symbol != "BTC" || quotes[0].Price != 2 || quotes[1].Symbol != "ETH" || quotes[1].Price != 3 {
+		t.Errorf("Ожидались BTC=2 и ETH=3, получено %v", quotes)
+	}
+
+	// Интервал без изменений - ничего не отправляется
+	clock.Advance(time.Second)
+	publish(server, sub, &pb.Quote{Symbol: "BTC", Price: 4})
+	clock.Advance(time.Second)
+	if quotes := stream.receive(t, 1); quotes[0].Price != 4 {
+		t.Errorf("Ожидалась BTC=4, получено %v", quotes)
+	}
+	if len(stream.sent) != 0 {
+		t.Errorf("Лишние котировки: %d", len(stream.sent))
+	}
+}
+
+// TestStreamQuotesFullTickInterval проверяет, что без конфляции тики не теряются
+func TestStreamQuotesFullTickInterval(t *testing.T) {
+	server, clock, stream, sub := startThrottledStream(t, &pb.QuoteRequest{IntervalMs: 500})
+
+	publish(server, sub, &pb.Quote{Symbol: "BTC", Price: 1}, &pb.Quote{Symbol: "BTC", Price: 2})
+	clock.Advance(500 * time.Millisecond)
+	if quotes := stream.receive(t, 2); quotes[0].Price != 1 || quotes[1].Price != 2 {
+		t.Errorf("Ожидались оба тика BTC по порядку, получено %v", quotes)
+	}
+}
+
+// TestStreamQuotesIntervalValidation проверяет минимальный интервал и режимы
+func TestStreamQuotesIntervalValidation(t *testing.T) {
+	server := newTestQuoteServer(newFakeClock())
+	stream := newFakeQuoteStream(context.Background())
+
+	for _, req := range []*pb.QuoteRequest{
+		{IntervalMs: 50},
+		{IntervalMs: -1},
+		{Mode: pb.DeliveryMode_CONFLATED},
+		{IntervalMs: 1000, Mode: pb.DeliveryMode(7)},
+	} {
+		if err := server.StreamQuotes(req, stream); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: ожидался InvalidArgument, получено %v", req, err)
+		}
+	}
+}
+
+// TestStreamQuotesReplayFinished проверяет, что по концу записи стрим отдаёт
+// накопленные котировки и завершается OUT_OF_RANGE
+func TestStreamQuotesReplayFinished(t *testing.T) {
+	clock := newFakeClock()
+	server := newTestQuoteServer(clock)
+	stream := newFakeQuoteStream(context.Background())
+
+	result := make(chan error, 1)
+	go func() { result <- server.StreamQuotes(&pb.QuoteRequest{IntervalMs: 500}, stream) }()
+	clock.WaitForTickers(t, 1)
+
+	server.hub.Publish(&pb.Quote{Symbol: "BTC", Price: 1})
+	server.hub.Close()
+
+	select {
+	case err := <-result:
+		if status.Code(err) != codes.OutOfRange {
+			t.Errorf("Ожидался OutOfRange, получено %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Стрим не завершился после конца записи")
+	}
+	if quotes := stream.receive(t, 1); quotes[0].Price != 1 {
+		t.Errorf("Накопленная котировка должна быть отправлена, получено %v", quotes)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Engine единственный генератор цен: владеет состоянием инструментов,
+// раз в interval сдвигает все цены и публикует тик в Hub
+type Engine struct {
+	mu          sync.Mutex
+	quotes      map[string]float64
+	last        map[string]*pb.Quote // Последний опубликованный тик символа
+	instruments map[string]Instrument
+	models      map[string]PriceModel
+	volumes     map[string]float64 // Накопленный объём за текущие сутки
+	volumeDay   string             // Сутки (UTC), к которым относится volumes
+	config      ModelConfig
+	rng         *rand.Rand
+	clock       Clock
+	interval    time.Duration
+	hub         *Hub
+}
+
+// NewEngine создаёт движок без инструментов. При одинаковом seed и одинаковом
+// наборе инструментов последовательность цен полностью воспроизводима;
+// seed = 0 означает случайное зерно.
+func NewEngine(hub *Hub, interval time.Duration, clock Clock, seed int64) *Engine {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Engine{
+		quotes:      make(map[string]float64),
+		last:        make(map[string]*pb.Quote),
+		instruments: make(map[string]Instrument),
+		models:      make(map[string]PriceModel),
+		volumes:     make(map[string]float64),
+		rng:         rand.New(rand.NewSource(seed)),
+		clock:       clock,
+		interval:    interval,
+		hub:         hub,
+	}
+}
+
+// Fork создаёт независимый движок с тем же набором инструментов и моделей,
+// стартующий с initial_price и собственным зерном
+func (e *Engine) Fork(hub *Hub, seed int64) *Engine {
+	e.mu.Lock()
+	instruments := make([]Instrument, 0, len(e.instruments))
+	for _, symbol := range e.symbolsLocked() {
+		instruments = append(instruments, e.instruments[symbol])
+	}
+	cfg := e.config
+	e.mu.Unlock()
+
+	fork := NewEngine(hub, e.interval, e.clock, seed)
+	fork.config = cfg
+	fork.ApplyInstruments(instruments)
+	return fork
+}
+
+// SetModelConfig задаёт модели из конфигурации и применяет их к текущим инструментам
+func (e *Engine) SetModelConfig(cfg ModelConfig) {
+	e.mu.Lock()
+	e.config = cfg
+	instruments := make([]Instrument, 0, len(e.instruments))
+	for _, inst := range e.instruments {
+		instruments = append(instruments, inst)
+	}
+	e.mu.Unlock()
+
+	e.ApplyInstruments(instruments)
+}
+
+// ApplyInstruments синхронизирует набор инструментов с переданным списком.
+// Новые активные инструменты начинают с initial_price, у существующих
+// сохраняется текущая цена (если initial_price не менялся), неактивные и
+// удалённые инструменты перестают стримиться. Модели из конфигурации
+// имеют приоритет над моделями из таблицы.
+func (e *Engine) ApplyInstruments(instruments []Instrument) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active := make(map[string]bool, len(instruments))
+	for _, inst := range e.config.Apply(instruments) {
+		if !inst.IsActive {
+			continue
+		}
+		if inst.Model == "" {
+			inst.Model = ModelUniform
+		}
+
+		model, err := NewPriceModel(inst)
+		if err != nil {
+			slog.Warn("⚠️ Некорректная модель цены, используем uniform", "symbol", inst.Symbol, "error", err)
+			inst.Model = ModelUniform
+			model = UniformModel{Volatility: inst.Volatility}
+		}
+		e.models[inst.Symbol] = model
+		active[inst.Symbol] = true
+
+		old, exists := e.instruments[inst.Symbol]
+		if exists && old.Model != inst.Model {
+			slog.Info("🔄 Модель цены изменена", "symbol", inst.Symbol, "from", old.Model, "to", inst.Model)
+		}
+		if !exists {
+			slog.Info("➕ Добавлен инструмент",
+				"symbol", inst.Symbol, "price", inst.InitialPrice, "volatility", inst.Volatility)
+			e.quotes[inst.Symbol] = inst.InitialPrice
+		} else if old.InitialPrice != inst.InitialPrice {
+			slog.Info("🔄 Начальная цена изменена",
+				"symbol", inst.Symbol, "from", old.InitialPrice, "to", inst.InitialPrice)
+			e.quotes[inst.Symbol] = inst.InitialPrice
+			delete(e.last, inst.Symbol)
+		}
+		e.instruments[inst.Symbol] = inst
+	}
+
+	for symbol := range e.instruments {
+		if !active[symbol] {
+			slog.Info("➖ Инструмент деактивирован", "symbol", symbol)
+			delete(e.instruments, symbol)
+			delete(e.models, symbol)
+			delete(e.volumes, symbol)
+			delete(e.quotes, symbol)
+			delete(e.last, symbol)
+		}
+	}
+}
+
+// LastQuote возвращает последний тик символа, а до первого тика - котировку
+// по текущей цене со спредом инструмента. Нужна для снимков, которые нельзя
+// откладывать до следующего тика.
+func (e *Engine) LastQuote(symbol string) (*pb.Quote, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if quote, ok := e.last[symbol]; ok {
+		return proto.Clone(quote).(*pb.Quote), true
+	}
+	price, ok := e.quotes[symbol]
+	if !ok {
+		return nil, false
+	}
+	halfSpread := price * e.instruments[symbol].SpreadBps / 10000 / 2
+	return &pb.Quote{
+		Symbol:    symbol,
+		Price:     price,
+		Timestamp: e.clock.Now().UnixMilli(),
+		Bid:       price - halfSpread,
+		Ask:       price + halfSpread,
+		BidSize:   initialQuoteSize,
+		AskSize:   initialQuoteSize,
+		Volume:    e.volumes[symbol],
+	}, true
+}
+
+// Instrument возвращает активный инструмент по тикеру
+func (e *Engine) Instrument(symbol string) (Instrument, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	inst, ok := e.instruments[symbol]
+	return inst, ok
+}
+
+// Instruments возвращает активные инструменты по алфавиту
+func (e *Engine) Instruments() []Instrument {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	symbols := e.symbolsLocked()
+	instruments := make([]Instrument, 0, len(symbols))
+	for _, symbol := range symbols {
+		instruments = append(instruments, e.instruments[symbol])
+	}
+	return instruments
+}
+
+// Symbols возвращает отсортированный список активных тикеров
+func (e *Engine) Symbols() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.symbolsLocked()
+}
+
+func (e *Engine) symbolsLocked() []string {
+	symbols := make([]string, 0, len(e.quotes))
+	for symbol := range e.quotes {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Run запускает цикл генерации цен до отмены контекста
+func (e *Engine) Run(ctx context.Context) {
+	ticker := e.clock.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			for _, quote := range e.tick(now) {
+				ticksGenerated.WithLabelValues(quote.Symbol).Inc()
+				e.hub.Publish(quote)
+			}
+		}
+	}
+}
+
+// tick сдвигает цены всех инструментов и возвращает новые котировки с временем now
+func (e *Engine) tick(now time.Time) []*pb.Quote {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Дневной объём обнуляется при смене суток
+	if day := now.UTC().Format("2006-01-02"); day != e.volumeDay {
+		e.volumeDay = day
+		clear(e.volumes)
+	}
+
+	timestamp := now.UnixMilli()
+	symbols := e.symbolsLocked()
+	quotes := make([]*pb.Quote, 0, len(symbols))
+	for _, symbol := range symbols {
+		newPrice := e.models[symbol].Next(e.quotes[symbol], e.interval, e.rng)
+		e.quotes[symbol] = newPrice
+
+		halfSpread := newPrice * e.instruments[symbol].SpreadBps / 10000 / 2
+		lastSize := randomSize(e.rng)
+		e.volumes[symbol] += lastSize
+
+		quote := &pb.Quote{
+			Symbol:    symbol,
+			Price:     newPrice,
+			Timestamp: timestamp,
+			Bid:       newPrice - halfSpread,
+			Ask:       newPrice + halfSpread,
+			BidSize:   randomSize(e.rng),
+			AskSize:   randomSize(e.rng),
+			LastSize:  lastSize,
+			Volume:    e.volumes[symbol],
+		}
+		e.last[symbol] = quote
+		quotes = append(quotes, quote)
+	}
+	return quotes
+}
+
+// initialQuoteSize объём лучших уровней котировки до первого тика (медиана randomSize)
+const initialQuoteSize = 10
+
+// randomSize генерирует объём с логнормальным распределением (медиана 10 лотов)
+func randomSize(rng *rand.Rand) float64 {
+	return math.Ceil(10 * math.Exp(rng.NormFloat64()))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestTickWithinVolatility проверяет, что шаг цены не превышает волатильность
+func TestTickWithinVolatility(t *testing.T) {
+	engine := NewEngine(NewHub(16, PolicyDropOldest), time.Second, realClock{}, 0)
+	engine.ApplyInstruments(defaultInstruments())
+
+	for i := 0; i < 100; i++ {
+		before := engine.quotes["SBER"]
+		var after float64
+		for _, quote := range engine.tick(time.Now()) {
+			if quote.Symbol == "SBER" {
+				after = quote.Price
+			}
+		}
+		if change := (after - before) / before; change > 0.001 || change < -0.001 {
+			t.Fatalf("Изменение %.5f вышло за пределы ±0.1%%", change)
+		}
+	}
+}
+
+// TestTickAllSymbolsOnce проверяет, что за тик каждая цена меняется ровно один раз
+func TestTickAllSymbolsOnce(t *testing.T) {
+	engine := NewEngine(NewHub(16, PolicyDropOldest), time.Second, realClock{}, 0)
+	engine.ApplyInstruments(defaultInstruments())
+
+	quotes := engine.tick(time.Now())
+	if len(quotes) != 3 {
+		t.Fatalf("Ожидалось 3 котировки за тик, получено %d", len(quotes))
+	}
+	for _, quote := range quotes {
+		if engine.quotes[quote.Symbol] != quote.Price {
+			t.Errorf("Цена %s в движке не совпадает с опубликованной", quote.Symbol)
+		}
+		if quote.Timestamp != quotes[0].Timestamp {
+			t.Error("Все котировки одного тика должны иметь одинаковый timestamp")
+		}
+	}
+}
+
+// TestSeedReproducible проверяет, что одинаковый seed даёт одинаковые цены
+func TestSeedReproducible(t *testing.T) {
+	run := func(seed int64) []float64 {
+		engine := NewEngine(NewHub(16, PolicyDropOldest), time.Second, newFakeClock(), seed)
+		engine.ApplyInstruments(defaultInstruments())
+
+		var prices []float64
+		for i := 0; i < 10; i++ {
+			for _, quote := range engine.tick(time.Now()) {
+				prices = append(prices, quote.Price)
+			}
+		}
+		return prices
+	}
+
+	first, second, other := run(42), run(42), run(43)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Цены с одинаковым seed разошлись на шаге %d: %.6f != %.6f", i, first[i], second[i])
+		}
+	}
+	if first[0] == other[0] {
+		t.Error("Разные seed должны давать разные цены")
+	}
+}
+
+// TestRunUsesClock проверяет, что движок тикает и ставит timestamp по часам
+func TestRunUsesClock(t *testing.T) {
+	clock := newFakeClock()
+	hub := NewHub(16, PolicyDropOldest)
+	engine := NewEngine(hub, time.Second, clock, 1)
+	engine.ApplyInstruments(defaultInstruments())
+	sub := hub.Subscribe([]string{"BTC"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+	clock.WaitForTickers(t, 1)
+
+	clock.Advance(2 * time.Second)
+
+	start := newFakeClock().Now()
+	for i := 1; i <= 2; i++ {
+		quote := <-sub.C
+		if want := start.Add(time.Duration(i) * time.Second).UnixMilli(); quote.Timestamp != want {
+			t.Errorf("Тик %d: ожидался timestamp %d, получено %d", i, want, quote.Timestamp)
+		}
+	}
+}
+
+// TestTickTopOfBook проверяет спред и объёмы в котировке
+func TestTickTopOfBook(t *testing.T) {
+	engine := NewEngine(NewHub(16, PolicyDropOldest), time.Second, realClock{}, 1)
+	engine.ApplyInstruments(defaultInstruments())
+	now := time.Date(2024, 1, 1, 23, 59, 58, 0, time.UTC)
+
+	var volume float64
+	for i := 0; i < 3; i++ {
+		for _, quote := range engine.tick(now.Add(time.Duration(i) * time.Second)) {
+			if quote.Symbol != "SBER" {
+				continue
+			}
+			if !(quote.Bid < quote.Price && quote.Price < quote.Ask) {
+				t.Fatalf("Ожидалось bid < price < ask, получено %v", quote)
+			}
+			// SBER: спред 5 б.п.
+			if spread := (quote.Ask - quote.Bid) / quote.Price; spread < 0.000499 || spread > 0.000501 {
+				t.Errorf("Ожидался спред 5 б.п., получено %.6f", spread)
+			}
+			if quote.LastSize <= 0 || quote.BidSize <= 0 || quote.AskSize <= 0 {
+				t.Errorf("Объёмы должны быть положительными: %v", quote)
+			}
+
+			// Третий тик приходится на следующие сутки - объём начинается заново
+			if i == 2 {
+				volume = 0
+			}
+			volume += quote.LastSize
+			if quote.Volume != volume {
+				t.Errorf("Тик %d: ожидался дневной объём %.0f, получено %.0f", i, volume, quote.Volume)
+			}
+		}
+	}
+}
+
+// TestLastQuote проверяет котировку до первого тика и последний тик после
+func TestLastQuote(t *testing.T) {
+	engine := NewEngine(NewHub(16, PolicyDropOldest), time.Second, realClock{}, 0)
+	engine.ApplyInstruments(defaultInstruments())
+
+	quote, ok := engine.LastQuote("BTC")
+	if !ok || quote.Price != 95400 || quote.Bid >= quote.Price || quote.Ask <= quote.Price || quote.BidSize == 0 {
+		t.Errorf("До тика ожидалась котировка по начальной цене со спредом, получено %v", quote)
+	}
+
+	var ticked float64
+	for _, q := range engine.tick(time.Now()) {
+		if q.Symbol == "BTC" {
+			ticked = q.Price
+		}
+	}
+	if quote, _ := engine.LastQuote("BTC"); quote.Price != ticked {
+		t.Errorf("Ожидался последний тик %v, получено %v", ticked, quote.Price)
+	}
+	if _, ok := engine.LastQuote("UNKNOWN"); ok {
+		t.Error("Для неизвестного символа котировки быть не должно")
+	}
+}
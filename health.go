@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"github.com/lib/pq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Health статус FT для grpc.health.v1: сервис "" (весь сервер) и
+// quotes.QuoteService. NOT_SERVING, пока источник инструментов недоступен
+// или сервер останавливается.
+type Health struct {
+	server *health.Server
+
+	mu        sync.Mutex
+	sourceErr error
+	draining  bool
+}
+
+// NewHealth создаёт статус SERVING
+func NewHealth() *Health {
+	h := &Health{server: health.NewServer()}
+	h.update()
+	return h
+}
+
+// Register регистрирует сервис Health на gRPC сервере
+func (h *Health) Register(server *grpc.Server) {
+	healthpb.RegisterHealthServer(server, h.server)
+}
+
+// SetSourceError запоминает результат последней загрузки инструментов (nil - успешно)
+func (h *Health) SetSourceError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if (err == nil) != (h.sourceErr == nil) {
+		switch {
+		case isSchemaError(err):
+			slog.Error("🩺 Схема БД не совпадает с ожидаемой, статус NOT_SERVING: выполните scripts/migrate.sql", "error", err)
+		case err != nil:
+			slog.Warn("🩺 Источник инструментов недоступен, статус NOT_SERVING", "error", err)
+		default:
+			slog.Info("🩺 Источник инструментов снова доступен, статус SERVING")
+		}
+	}
+	h.sourceErr = err
+	h.updateLocked()
+}
+
+// Drain переводит сервер в NOT_SERVING до конца работы процесса
+func (h *Health) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.draining = true
+	h.updateLocked()
+}
+
+// isSchemaError ошибка схемы БД (нет колонки или таблицы): БД доступна, но том
+// postgres_data создан старым init.sql и миграция не выполнена
+func isSchemaError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "42703" || pqErr.Code == "42P01")
+}
+
+func (h *Health) update() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.updateLocked()
+}
+
+func (h *Health) updateLocked() {
+	status := healthpb.HealthCheckResponse_SERVING
+	if h.draining || h.sourceErr != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, service := range []string{"", pb.QuoteService_ServiceDesc.ServiceName} {
+		h.server.SetServingStatus(service, status)
+	}
+}
+
+// probeHealth проверяет статус сервера по адресу addr; используется
+// флагом -health для healthcheck в docker-compose
+func probeHealth(addr string) error {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("статус %s", resp.Status)
+	}
+	return nil
+}
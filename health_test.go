@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	pb "ft-mt/proto"
+
+	"github.com/lib/pq"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestHealthStatus проверяет переключение статуса по источнику инструментов и остановке
+func TestHealthStatus(t *testing.T) {
+	h := NewHealth()
+	check := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		for _, service := range []string{"", pb.QuoteService_ServiceDesc.ServiceName} {
+			resp, err := h.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err != nil || resp.Status != want {
+				t.Errorf("Сервис %q: ожидался %s, получено %v, %v", service, want, resp.GetStatus(), err)
+			}
+		}
+	}
+
+	check(healthpb.HealthCheckResponse_SERVING)
+	h.SetSourceError(errors.New("connection refused"))
+	check(healthpb.HealthCheckResponse_NOT_SERVING)
+	h.SetSourceError(nil)
+	check(healthpb.HealthCheckResponse_SERVING)
+
+	h.Drain()
+	h.SetSourceError(nil)
+	check(healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// TestIsSchemaError проверяет распознавание устаревшей схемы БД
+func TestIsSchemaError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "42703", Message: `column "spread_bps" does not exist`}, true},
+		{fmt.Errorf("load: %w", &pq.Error{Code: "42P01"}), true},
+		{&pq.Error{Code: "28P01"}, false},
+		{errors.New("connection refused"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := isSchemaError(tt.err); got != tt.want {
+			t.Errorf("isSchemaError(%v) = %v, ожидалось %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// TestProbeHealth проверяет проверку статуса по сети, как в healthcheck docker-compose
+func TestProbeHealth(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	h := NewHealth()
+	h.Register(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	if err := probeHealth(listener.Addr().String()); err != nil {
+		t.Errorf("Ожидался SERVING, получено %v", err)
+	}
+	h.Drain()
+	if err := probeHealth(listener.Addr().String()); err == nil {
+		t.Error("После Drain проверка должна завершаться ошибкой")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"ft-mt/internal/logging"
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ограничения размера страницы GetHistory
+const (
+	defaultHistoryLimit = 1000
+	maxHistoryLimit     = 10000
+)
+
+// Хранение истории: тики старше TICK_RETENTION удаляются раз в tickPruneInterval
+const (
+	defaultTickRetention = 7 * 24 * time.Hour
+	tickPruneInterval    = 10 * time.Minute
+)
+
+// openTickStore выбирает хранилище тиков по TICK_STORE: postgres, file или none
+func openTickStore(db *sql.DB) (TickStore, error) {
+	switch backend := getEnv("TICK_STORE", "none"); backend {
+	case "none":
+		return nil, nil
+	case "postgres":
+		return NewPostgresTickStore(db), nil
+	case "file":
+		return NewFileTickStore(getEnv("TICK_STORE_DIR", "./data/ticks"))
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище тиков %q (ожидается postgres, file или none)", backend)
+	}
+}
+
+// startTickRecorder запускает асинхронную запись тиков хаба в хранилище.
+// Возвращённый канал закрывается, когда после отмены ctx записаны все тики.
+func startTickRecorder(ctx context.Context, store TickStore, hub *Hub) (<-chan struct{}, error) {
+	batchSize, err := strconv.Atoi(getEnv("TICK_BATCH_SIZE", "500"))
+	if err != nil || batchSize <= 0 {
+		return nil, fmt.Errorf("некорректный TICK_BATCH_SIZE: %q", getEnv("TICK_BATCH_SIZE", "500"))
+	}
+	flushInterval, err := time.ParseDuration(getEnv("TICK_FLUSH_INTERVAL", "1s"))
+	if err != nil {
+		return nil, fmt.Errorf("некорректный TICK_FLUSH_INTERVAL: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewTickRecorder(store, batchSize, flushInterval, 16).Run(ctx, hub)
+	}()
+	return done, nil
+}
+
+// startTickPruner запускает удаление тиков старше TICK_RETENTION (0 - хранить всё)
+func startTickPruner(ctx context.Context, store TickStore) error {
+	value := getEnv("TICK_RETENTION", defaultTickRetention.String())
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention < 0 {
+		return fmt.Errorf("некорректный TICK_RETENTION: %q", value)
+	}
+	if retention == 0 {
+		return nil
+	}
+	pruner, ok := store.(TickPruner)
+	if !ok {
+		slog.Warn("⚠️ Хранилище тиков не поддерживает TICK_RETENTION, история не удаляется",
+			"store", getEnv("TICK_STORE", "none"))
+		return nil
+	}
+	go runTickPruner(ctx, pruner, retention, tickPruneInterval, realClock{})
+	return nil
+}
+
+// runTickPruner удаляет тики старше retention сразу и затем раз в interval до отмены ctx
+func runTickPruner(ctx context.Context, pruner TickPruner, retention, interval time.Duration, clock Clock) {
+	prune := func() {
+		pruned, err := pruner.Prune(ctx, clock.Now().Add(-retention).UnixMilli())
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("⚠️ Не удалось удалить старые тики", "error", err)
+			}
+			return
+		}
+		if pruned > 0 {
+			slog.Debug("🧹 Удалены тики старше TICK_RETENTION", "count", pruned, "retention", retention.String())
+		}
+	}
+
+	prune()
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			prune()
+		}
+	}
+}
+
+// GetHistory возвращает страницу сохранённых тиков символа
+func (s *QuoteServer) GetHistory(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	if s.ticks == nil {
+		return nil, status.Error(codes.FailedPrecondition, "tick history is disabled (TICK_STORE=none)")
+	}
+	if req.Symbol == "" {
+		return nil, status.Error(codes.InvalidArgument, "symbol is required")
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must not exceed %d", maxHistoryLimit)
+	}
+	to := req.To
+	if to == 0 {
+		to = time.Now().UnixMilli()
+	}
+	if req.From > to {
+		return nil, status.Error(codes.InvalidArgument, "from must not be after to")
+	}
+
+	// Курсор {from, 0} - с начала миллисекунды from; next_cursor продолжает
+	// после последнего отданного тика, даже если за ним тики той же миллисекунды
+	after := TickCursor{Timestamp: req.From}
+	if req.Cursor != "" {
+		cursor, err := ParseTickCursor(req.Cursor)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid cursor %q", req.Cursor)
+		}
+		after = cursor
+	}
+
+	// Запрашиваем на один тик больше, чтобы узнать, есть ли следующая страница
+	ticks, err := s.ticks.Query(ctx, req.Symbol, after, to, limit+1)
+	if err != nil {
+		logging.FromContext(ctx).Error("Ошибка чтения истории", "symbol", req.Symbol, "error", err)
+		return nil, status.Error(codes.Internal, "failed to read tick history")
+	}
+
+	resp := &pb.HistoryResponse{}
+	if len(ticks) > limit {
+		ticks = ticks[:limit]
+		resp.HasMore = true
+		resp.NextCursor = ticks[limit-1].Cursor.String()
+	}
+	resp.Quotes = make([]*pb.Quote, len(ticks))
+	for i, tick := range ticks {
+		resp.Quotes[i] = tick.Quote
+	}
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Issuer и тип (claim typ) access токенов auth-service
+const (
+	accessTokenIssuer = "quotopia-auth"
+	accessTokenType   = "access"
+)
+
+// AccessClaims claims access токена auth-service
+type AccessClaims struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	Type   string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// authCheckTimeout сколько ждать ответа auth-service при проверке отзыва
+const authCheckTimeout = 3 * time.Second
+
+var (
+	// errNoToken запрос без токена
+	errNoToken = errors.New("token is required")
+	// errTokenRevoked auth-service отклонил токен: выход, смена пароля, роли или блокировка
+	errTokenRevoked = errors.New("token is revoked")
+	// errAuthUnavailable auth-service не ответил, отзыв проверить нельзя
+	errAuthUnavailable = errors.New("auth service is unavailable")
+)
+
+// TokenVerifier проверяет access токены, выданные auth-service (общий JWT_SECRET).
+// Подпись проверяется локально, а отзыв (jti после выхода, token_version после
+// выхода со всех устройств, смены пароля, роли или блокировки) знает только
+// auth-service: его спрашиваем через GET /auth/me.
+type TokenVerifier struct {
+	secret  []byte
+	authURL string // Пусто - только подпись (тесты)
+	client  *http.Client
+}
+
+// NewTokenVerifier создаёт проверку токенов с общим секретом и адресом auth-service
+func NewTokenVerifier(secret, authURL string) *TokenVerifier {
+	return &TokenVerifier{
+		secret:  []byte(secret),
+		authURL: strings.TrimSuffix(authURL, "/"),
+		client:  &http.Client{Timeout: authCheckTimeout},
+	}
+}
+
+// Verify проверяет токен локально и затем в auth-service. Отозванный токен -
+// errTokenRevoked; если auth-service недоступен - errAuthUnavailable: токен
+// не принимается, раз отзыв не проверен.
+func (v *TokenVerifier) Verify(ctx context.Context, tokenString string) (*AccessClaims, error) {
+	claims, err := v.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if v.authURL != "" {
+		if err := v.checkRevoked(ctx, tokenString); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// parse разбирает и проверяет подпись, срок действия, issuer и тип токена:
+// refresh токен подписан тем же секретом, но не даёт доступа
+func (v *TokenVerifier) parse(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (any, error) {
+		return v.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(accessTokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != accessTokenType {
+		return nil, fmt.Errorf("token type %q is not %q", claims.Type, accessTokenType)
+	}
+	return claims, nil
+}
+
+// checkRevoked спрашивает auth-service, действует ли ещё токен
+func (v *TokenVerifier) checkRevoked(ctx context.Context, tokenString string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.authURL+"/auth/me", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errAuthUnavailable, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errTokenRevoked
+	default:
+		return fmt.Errorf("%w: status %d", errAuthUnavailable, resp.StatusCode)
+	}
+}
+
+// requestToken токен из заголовка Authorization: Bearer или параметра token
+// (браузерный WebSocket не умеет передавать заголовки)
+func requestToken(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			return "", errors.New("authorization header must be Bearer")
+		}
+		return token, nil
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, nil
+	}
+	return "", errNoToken
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signToken подписывает access токен так же, как auth-service
+func signToken(t *testing.T, secret, issuer string, expiresAt time.Time) string {
+	return signTypedToken(t, secret, issuer, accessTokenType, expiresAt)
+}
+
+func signTypedToken(t *testing.T, secret, issuer, typ string, expiresAt time.Time) string {
+	t.Helper()
+	claims := AccessClaims{
+		UserID: 7,
+		Email:  "trader@example.com",
+		Role:   "user",
+		Type:   typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    issuer,
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokenVerifier(t *testing.T) {
+	verifier := NewTokenVerifier("secret", "")
+	hour := time.Now().Add(time.Hour)
+
+	claims, err := verifier.Verify(context.Background(), signToken(t, "secret", accessTokenIssuer, hour))
+	if err != nil || claims.UserID != 7 {
+		t.Fatalf("Валидный токен отклонён: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"чужой секрет":   signToken(t, "other", accessTokenIssuer, hour),
+		"refresh токен":  signToken(t, "secret", "quotopia-auth-refresh", hour),
+		"typ refresh":    signTypedToken(t, "secret", accessTokenIssuer, "refresh", hour),
+		"без typ":        signTypedToken(t, "secret", accessTokenIssuer, "", hour),
+		"истёкший токен": signToken(t, "secret", accessTokenIssuer, time.Now().Add(-time.Minute)),
+		"не JWT":         "garbage",
+	} {
+		if _, err := verifier.Verify(context.Background(), token); err == nil {
+			t.Errorf("%s: ожидалась ошибка", name)
+		}
+	}
+}
+
+// startFakeAuth поднимает auth-service, отвечающий на GET /auth/me статусом status()
+func startFakeAuth(t *testing.T, status func() int) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/auth/me" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status())
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestTokenVerifierAuthService(t *testing.T) {
+	token := signToken(t, "secret", accessTokenIssuer, time.Now().Add(time.Hour))
+
+	for name, tc := range map[string]struct {
+		status int
+		want   error
+	}{
+		"действует":      {http.StatusOK, nil},
+		"отозван":        {http.StatusUnauthorized, errTokenRevoked},
+		"заблокирован":   {http.StatusForbidden, errTokenRevoked},
+		"ошибка сервиса": {http.StatusInternalServerError, errAuthUnavailable},
+	} {
+		url := startFakeAuth(t, func() int { return tc.status })
+		_, err := NewTokenVerifier("secret", url).Verify(context.Background(), token)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: ожидалось %v, получено %v", name, tc.want, err)
+		}
+	}
+
+	// Недоступный auth-service: отзыв не проверен, токен не принимается
+	stopped := httptest.NewServer(http.NotFoundHandler())
+	stopped.Close()
+	down := NewTokenVerifier("secret", stopped.URL)
+	if _, err := down.Verify(context.Background(), token); !errors.Is(err, errAuthUnavailable) {
+		t.Errorf("Ожидалась errAuthUnavailable, получено %v", err)
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/ws?token=query", nil)
+	if token, err := requestToken(req); err != nil || token != "query" {
+		t.Errorf("Ожидался токен из параметра, получено %q %v", token, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer header")
+	if token, err := requestToken(req); err != nil || token != "header" {
+		t.Errorf("Заголовок важнее параметра, получено %q %v", token, err)
+	}
+
+	req.Header.Set("Authorization", "Basic abc")
+	if _, err := requestToken(req); err == nil {
+		t.Error("Ожидалась ошибка для не Bearer заголовка")
+	}
+
+	if _, err := requestToken(httptest.NewRequest("GET", "/ws", nil)); err != errNoToken {
+		t.Errorf("Ожидалась errNoToken, получено %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"ft-mt/internal/logging"
+	pb "ft-mt/proto"
+)
+
+// candlesHandler отдаёт историю закрытых свечей и текущую (closed=false), если
+// она уже открыта. Ответ собирается целиком до записи: ошибка стрима даёт
+// 4xx/5xx, а не обрезанный 200.
+func candlesHandler(client pb.QuoteServiceClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		snapshot, err := fetchCandles(ctx, client, &pb.CandleRequest{
+			Symbol:   c.Param("symbol"),
+			Interval: c.DefaultQuery("interval", "1m"),
+			History:  int32(limit),
+		})
+		if err != nil {
+			code := candleErrorStatus(err)
+			if code >= http.StatusInternalServerError {
+				logging.FromContext(ctx).Error("❌ Ошибка получения свечей", "error", err)
+			}
+			c.JSON(code, gin.H{"error": status.Convert(err).Message()})
+			return
+		}
+
+		candles := make([]gin.H, 0, len(snapshot))
+		for _, candle := range snapshot {
+			candles = append(candles, gin.H{
+				"symbol":     candle.Symbol,
+				"interval":   candle.Interval,
+				"open_time":  candle.OpenTime,
+				"close_time": candle.CloseTime,
+				"open":       candle.Open,
+				"high":       candle.High,
+				"low":        candle.Low,
+				"close":      candle.Close,
+				"volume":     candle.Volume,
+				"closed":     candle.Closed,
+			})
+		}
+		c.JSON(http.StatusOK, candles)
+	}
+}
+
+// fetchCandles читает из StreamCandles только снимок: число свечей FT сообщает
+// в заголовке x-candle-snapshot, поэтому следующего тика ждать не нужно
+func fetchCandles(ctx context.Context, client pb.QuoteServiceClient, req *pb.CandleRequest) ([]*pb.Candle, error) {
+	// Отмена закрывает стрим после снимка: live-обновления не нужны
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.StreamCandles(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	header, err := stream.Header()
+	if err != nil {
+		return nil, err
+	}
+	values := header.Get(pb.CandleSnapshotHeader)
+	if len(values) == 0 {
+		// Стрим завершился без заголовка (например, INVALID_ARGUMENT): статус отдаёт Recv
+		if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Internal, "candle stream has no %s header", pb.CandleSnapshotHeader)
+	}
+	count, err := strconv.Atoi(values[0])
+	if err != nil || count < 0 {
+		return nil, status.Errorf(codes.Internal, "invalid %s header %q", pb.CandleSnapshotHeader, values[0])
+	}
+
+	candles := make([]*pb.Candle, 0, count)
+	for len(candles) < count {
+		candle, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil, status.Error(codes.Unavailable, "candle stream ended before snapshot")
+		}
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// candleErrorStatus HTTP статус для ошибки стрима свечей
+func candleErrorStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unavailable, codes.ResourceExhausted:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "ft-mt/proto"
+)
+
+// StreamCandles отдаёт снимок свечей fakeFT; без candleErr стрим ждёт тиков,
+// которых не будет
+func (f *fakeFT) StreamCandles(req *pb.CandleRequest, stream grpc.ServerStreamingServer[pb.Candle]) error {
+	if req.Interval != "1m" {
+		return status.Error(codes.InvalidArgument, "unsupported interval")
+	}
+	if err := stream.SendHeader(metadata.Pairs(pb.CandleSnapshotHeader, strconv.Itoa(len(f.candles)))); err != nil {
+		return err
+	}
+	for _, candle := range f.candles {
+		if err := stream.Send(candle); err != nil {
+			return err
+		}
+		if f.candleErr != nil {
+			// Обрыв посреди снимка
+			return f.candleErr
+		}
+	}
+	<-stream.Context().Done()
+	return stream.Context().Err()
+}
+
+// getCandles выполняет GET /candles/BTC с query
+func getCandles(t *testing.T, ft *fakeFT, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/candles/:symbol", candlesHandler(startFakeFT(t, ft)))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/candles/BTC"+query, nil))
+	return w
+}
+
+// TestCandlesHandlerWithoutOpenCandle проверяет, что история без текущей свечи
+// отдаётся сразу, без ожидания следующего тика
+func TestCandlesHandlerWithoutOpenCandle(t *testing.T) {
+	ft := newFakeFT()
+	ft.candles = []*pb.Candle{
+		{Symbol: "BTC", Interval: "1m", OpenTime: 0, Close: 100, Closed: true},
+		{Symbol: "BTC", Interval: "1m", OpenTime: 60000, Close: 101, Closed: true},
+	}
+
+	start := time.Now()
+	w := getCandles(t, ft, "")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Ответ должен прийти сразу, прошло %s", elapsed)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Ожидался 200, получено %d: %s", w.Code, w.Body)
+	}
+	var candles []struct {
+		Close  float64 `json:"close"`
+		Closed bool    `json:"closed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &candles); err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 || candles[1].Close != 101 || !candles[1].Closed {
+		t.Errorf("Ожидались две закрытые свечи, получено %+v", candles)
+	}
+}
+
+// TestCandlesHandlerEmpty проверяет пустой массив, если свечей ещё нет
+func TestCandlesHandlerEmpty(t *testing.T) {
+	w := getCandles(t, newFakeFT(), "")
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("Ожидался 200 [], получено %d %s", w.Code, w.Body)
+	}
+}
+
+// TestCandlesHandlerErrors проверяет, что ошибки FT не превращаются в частичный 200
+func TestCandlesHandlerErrors(t *testing.T) {
+	w := getCandles(t, newFakeFT(), "?interval=7m")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Неверный интервал: ожидался 400, получено %d %s", w.Code, w.Body)
+	}
+
+	ft := newFakeFT()
+	ft.candles = []*pb.Candle{{Symbol: "BTC", Closed: true}, {Symbol: "BTC"}}
+	ft.candleErr = status.Error(codes.Unavailable, "server is shutting down")
+	w = getCandles(t, ft, "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Обрыв посреди снимка: ожидался 503, получено %d %s", w.Code, w.Body)
+	}
+
+	if got := candleErrorStatus(status.Error(codes.DeadlineExceeded, "timeout")); got != http.StatusGatewayTimeout {
+		t.Errorf("DEADLINE_EXCEEDED: ожидался 504, получено %d", got)
+	}
+}
@@ -2,41 +2,114 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
+	"ft-mt/internal/logging"
+	"ft-mt/internal/metrics"
+	"ft-mt/internal/tracing"
 	pb "ft-mt/proto"
 )
 
 func main() {
+	if err := logging.Setup("ht"); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки логов: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Получаем адрес gRPC сервера из переменной окружения
 	grpcAddr := os.Getenv("GRPC_SERVER")
 	if grpcAddr == "" {
 		grpcAddr = "localhost:50051" // Fallback для локальной разработки
 	}
 
-	log.Printf("🔌 Подключаюсь к gRPC серверу: %s", grpcAddr)
+	shutdownTracing, err := tracing.Setup(context.Background(), "ht")
+	if err != nil {
+		logging.Fatal("❌ Ошибка настройки трейсинга", "error", err)
+	}
 
-	conn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	slog.Info("🔌 Подключаюсь к gRPC серверу", "addr", grpcAddr)
+
+	conn, err := grpc.Dial(grpcAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		// Контекст трейса запроса уходит в FT через metadata (traceparent)
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		// Request ID запроса уходит в FT через metadata (x-request-id)
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor(), metrics.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(logging.StreamClientInterceptor(), metrics.StreamClientInterceptor()),
+	)
 	if err != nil {
-		log.Fatalf("❌ Не удалось подключиться к gRPC серверу: %v", err)
+		logging.Fatal("❌ Не удалось подключиться к gRPC серверу", "error", err)
 	}
 	defer conn.Close()
 
 	client := pb.NewQuoteServiceClient(conn)
-	r := gin.Default()
+
+	staleAfter, err := time.ParseDuration(getEnv("QUOTES_STALE_AFTER", defaultStaleAfter.String()))
+	if err != nil || staleAfter <= 0 {
+		logging.Fatal("❌ Некорректный QUOTES_STALE_AFTER", "value", getEnv("QUOTES_STALE_AFTER", ""))
+	}
+	maxBackoff, err := time.ParseDuration(getEnv("UPSTREAM_BACKOFF_MAX", defaultMaxUpstreamBackoff.String()))
+	if err != nil || maxBackoff < minUpstreamBackoff {
+		logging.Fatal("❌ Некорректный UPSTREAM_BACKOFF_MAX", "value", getEnv("UPSTREAM_BACKOFF_MAX", ""))
+	}
+	sseHeartbeat, err := time.ParseDuration(getEnv("SSE_HEARTBEAT", defaultSSEHeartbeat.String()))
+	if err != nil || sseHeartbeat <= 0 {
+		logging.Fatal("❌ Некорректный SSE_HEARTBEAT", "value", getEnv("SSE_HEARTBEAT", ""))
+	}
+	wsCfg := WSConfig{RequireAuth: getEnv("WS_REQUIRE_AUTH", "false") == "true"}
+	wsCfg.MaxSubscriptions, err = strconv.Atoi(getEnv("WS_MAX_SUBSCRIPTIONS", strconv.Itoa(defaultWSMaxSubscriptions)))
+	if err != nil || wsCfg.MaxSubscriptions <= 0 {
+		logging.Fatal("❌ Некорректный WS_MAX_SUBSCRIPTIONS", "value", getEnv("WS_MAX_SUBSCRIPTIONS", ""))
+	}
+	wsCfg.PingInterval, err = time.ParseDuration(getEnv("WS_PING_INTERVAL", defaultWSPingInterval.String()))
+	if err != nil || wsCfg.PingInterval <= 0 {
+		logging.Fatal("❌ Некорректный WS_PING_INTERVAL", "value", getEnv("WS_PING_INTERVAL", ""))
+	}
+	wsCfg.AuthRecheck, err = time.ParseDuration(getEnv("WS_AUTH_RECHECK", defaultWSAuthRecheck.String()))
+	if err != nil || wsCfg.AuthRecheck <= 0 {
+		logging.Fatal("❌ Некорректный WS_AUTH_RECHECK", "value", getEnv("WS_AUTH_RECHECK", ""))
+	}
+	// Токены выдаёт auth-service, секрет общий; отзыв токенов проверяет он же
+	wsCfg.Verifier = NewTokenVerifier(
+		getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
+		getEnv("AUTH_URL", "http://localhost:8090"),
+	)
+
+	// Одна подписка на FT на весь процесс: /quotes отвечает из кеша
+	cacheCtx, stopCache := context.WithCancel(context.Background())
+	defer stopCache()
+	cache := NewQuoteCache(client, staleAfter, maxBackoff)
+	go cache.Run(cacheCtx)
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(otelgin.Middleware("ht"))
+	r.Use(logging.GinMiddleware())
+	r.Use(metrics.GinMiddleware())
 
 	// Добавляем CORS для локальной разработки
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Last-Event-ID, "+logging.RequestIDHeader)
+		c.Writer.Header().Set("Access-Control-Expose-Headers",
+			logging.RequestIDHeader+", "+quotesStaleHeader+", "+quotesUpdatedAtHeader)
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -44,45 +117,164 @@ func main() {
 		c.Next()
 	})
 
-	r.GET("/quotes", func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	r.GET("/quotes", quotesHandler(cache))
+	// Живые котировки: Server-Sent Events с возобновлением по Last-Event-ID
+	r.GET("/quotes/stream", quoteStreamHandler(cache, sseHeartbeat))
+	// WebSocket: подписка сообщениями subscribe/unsubscribe, опционально с JWT
+	r.GET("/ws", NewWSGateway(cache, client, wsCfg).Handle)
+
+	// Свечи: история закрытых свечей + текущая (closed=false) последней
+	r.GET("/candles/:symbol", candlesHandler(client))
+
+	// История тиков постранично: следующая страница запрашивается с cursor=next_cursor
+	r.GET("/history/:symbol", func(c *gin.Context) {
+		var params struct {
+			From   int64  `form:"from"`
+			To     int64  `form:"to"`
+			Limit  int32  `form:"limit"`
+			Cursor string `form:"cursor"`
+		}
+		if err := c.ShouldBindQuery(&params); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		stream, err := client.StreamQuotes(ctx, &pb.QuoteRequest{
-			Symbols: []string{"BTC", "ETH", "SBER"},
+		resp, err := client.GetHistory(ctx, &pb.HistoryRequest{
+			Symbol: c.Param("symbol"),
+			From:   params.From,
+			To:     params.To,
+			Limit:  params.Limit,
+			Cursor: params.Cursor,
 		})
 		if err != nil {
-			log.Printf("❌ Ошибка создания стрима: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			switch status.Code(err) {
+			case codes.InvalidArgument:
+				c.JSON(http.StatusBadRequest, gin.H{"error": status.Convert(err).Message()})
+			case codes.FailedPrecondition:
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": status.Convert(err).Message()})
+			default:
+				logging.FromContext(ctx).Error("❌ Ошибка получения истории", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
 			return
 		}
 
-		// Собираем только последние котировки для каждого символа
-		latestQuotes := make(map[string]gin.H)
+		ticks := make([]gin.H, 0, len(resp.Quotes))
+		for _, quote := range resp.Quotes {
+			ticks = append(ticks, quoteJSON(quote))
+		}
 
-		for {
-			quote, err := stream.Recv()
-			if err != nil {
-				break
-			}
-			// Перезаписываем, чтобы сохранить только последнее значение
-			latestQuotes[quote.Symbol] = gin.H{
-				"symbol":    quote.Symbol,
-				"price":     quote.Price,
-				"timestamp": quote.Timestamp,
-			}
+		result := gin.H{
+			"symbol":   c.Param("symbol"),
+			"ticks":    ticks,
+			"has_more": resp.HasMore,
+		}
+		if resp.HasMore {
+			result["next_cursor"] = resp.NextCursor
 		}
+		c.JSON(http.StatusOK, result)
+	})
 
-		// Преобразуем map в slice
-		quotes := make([]gin.H, 0, len(latestQuotes))
-		for _, quote := range latestQuotes {
-			quotes = append(quotes, quote)
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "10s"))
+	if err != nil {
+		logging.Fatal("❌ Некорректный SHUTDOWN_TIMEOUT", "error", err)
+	}
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	// SSE потоки сами не завершаются, и Shutdown ждал бы их до таймаута, а WebSocket соединения
+	// он не отслеживает: закрываем ленту, браузеры переподключатся
+	srv.RegisterOnShutdown(cache.feed.Close)
+	go func() {
+		slog.Info("🚀 HT (HTTP Gateway) запущен", "addr", ":8080")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("❌ Ошибка запуска сервера", "error", err)
 		}
+	}()
 
-		log.Printf("📊 Отправлено %d котировок", len(quotes))
+	// Prometheus метрики на отдельном HTTP порту: nginx проксирует только :8080
+	metricsServer := &http.Server{Addr: getEnv("METRICS_ADDR", ":9101"), Handler: metrics.Handler()}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("⚠️ Сервер метрик остановлен", "error", err)
+		}
+	}()
+
+	// Ждём SIGINT/SIGTERM и даём текущим запросам завершиться
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-signals.Done()
+	stop()
+
+	slog.Info("🛑 Остановка HT, ожидание завершения запросов", "timeout", shutdownTimeout.String())
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("⚠️ Не все запросы завершились", "error", err)
+	}
+	metricsServer.Close()
+	stopCache()
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("⚠️ Не удалось отправить спаны", "error", err)
+	}
+	slog.Info("👋 HT остановлен")
+}
+
+// Заголовки /quotes о свежести кеша: тело остаётся массивом котировок
+const (
+	quotesStaleHeader     = "X-Quotes-Stale"
+	quotesUpdatedAtHeader = "X-Quotes-Updated-At"
+)
+
+// quotesHandler отдаёт последние котировки из кеша без обращения к FT.
+// X-Quotes-Stale: true, если поток из FT оборван или котировки давно не
+// приходили; 503 - если котировок ещё нет совсем.
+func quotesHandler(cache *QuoteCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot := cache.Snapshot()
+		c.Header(quotesStaleHeader, strconv.FormatBool(snapshot.Stale))
+		if !snapshot.UpdatedAt.IsZero() {
+			c.Header(quotesUpdatedAtHeader, strconv.FormatInt(snapshot.UpdatedAt.UnixMilli(), 10))
+		}
+		if len(snapshot.Quotes) == 0 && snapshot.Stale {
+			message := "quotes are not available yet"
+			if snapshot.Err != nil {
+				message = "quote source is unavailable"
+			}
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": message, "stale": true})
+			return
+		}
+
+		quotes := make([]gin.H, 0, len(snapshot.Quotes))
+		for _, quote := range snapshot.Quotes {
+			quotes = append(quotes, quoteJSON(quote))
+		}
 		c.JSON(http.StatusOK, quotes)
-	})
+	}
+}
+
+// quoteJSON представление котировки в JSON ответах
+func quoteJSON(quote *pb.Quote) gin.H {
+	return gin.H{
+		"symbol":    quote.Symbol,
+		"price":     quote.Price,
+		"timestamp": quote.Timestamp,
+		"bid":       quote.Bid,
+		"ask":       quote.Ask,
+		"bid_size":  quote.BidSize,
+		"ask_size":  quote.AskSize,
+		"last_size": quote.LastSize,
+		"volume":    quote.Volume,
+	}
+}
 
-	log.Println("🚀 HT (HTTP Gateway) запущен на порту 8080")
-	r.Run(":8080")
+// getEnv получить переменную окружения с дефолтным значением
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
 }
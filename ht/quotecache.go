@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	pb "ft-mt/proto"
+)
+
+const (
+	// defaultStaleAfter через сколько без новых котировок кеш считается устаревшим
+	defaultStaleAfter = 5 * time.Second
+	// minUpstreamBackoff первая пауза перед переподключением к FT
+	minUpstreamBackoff = 500 * time.Millisecond
+	// defaultMaxUpstreamBackoff максимальная пауза перед переподключением к FT
+	defaultMaxUpstreamBackoff = 30 * time.Second
+)
+
+// Метрики подписки HT на FT
+var (
+	upstreamConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ht_upstream_connected",
+		Help: "1, если поток котировок из FT открыт и данные приходят.",
+	})
+	upstreamReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ht_upstream_reconnects_total",
+		Help: "Переподключения к потоку котировок FT.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(upstreamConnected, upstreamReconnects)
+}
+
+// cachedQuote котировка и момент её получения
+type cachedQuote struct {
+	quote      *pb.Quote
+	receivedAt time.Time
+}
+
+// QuoteCache держит одну долгоживущую подписку на все котировки FT и
+// хранит последнюю котировку каждого символа. При обрыве потока
+// переподключается с экспоненциальной паузой, отдавая накопленные
+// котировки с признаком stale.
+type QuoteCache struct {
+	client     pb.QuoteServiceClient
+	staleAfter time.Duration
+	maxBackoff time.Duration
+	now        func() time.Time
+	feed       *QuoteFeed // Нумерованная лента котировок для SSE
+
+	mu        sync.RWMutex
+	quotes    map[string]cachedQuote
+	connected bool
+	updatedAt time.Time
+	lastErr   error
+}
+
+// NewQuoteCache создаёт пустой кеш; подписка запускается через Run
+func NewQuoteCache(client pb.QuoteServiceClient, staleAfter, maxBackoff time.Duration) *QuoteCache {
+	return &QuoteCache{
+		client:     client,
+		staleAfter: staleAfter,
+		maxBackoff: maxBackoff,
+		now:        time.Now,
+		feed:       NewQuoteFeed(defaultFeedHistory),
+		quotes:     make(map[string]cachedQuote),
+	}
+}
+
+// QuoteSnapshot содержимое кеша на момент запроса
+type QuoteSnapshot struct {
+	Quotes    []*pb.Quote // По алфавиту символов
+	Stale     bool        // Поток FT оборван или котировки давно не приходили
+	UpdatedAt time.Time   // Время последней полученной котировки (zero - ещё не было)
+	Err       error       // Последняя ошибка потока, если он оборван
+}
+
+// Run держит подписку до отмены контекста
+func (c *QuoteCache) Run(ctx context.Context) {
+	backoff := minUpstreamBackoff
+	for {
+		received, err := c.stream(ctx)
+		if ctx.Err() != nil {
+			c.setDisconnected(ctx.Err())
+			return
+		}
+		c.setDisconnected(err)
+		upstreamReconnects.Inc()
+
+		// Поток успел поработать - начинаем паузы заново
+		if received {
+			backoff = minUpstreamBackoff
+		}
+		wait := jitter(backoff)
+		slog.Warn("⚠️ Поток котировок FT прерван, переподключение", "error", err, "retry_in", wait.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+// stream читает котировки до ошибки; received - пришла ли хотя бы одна
+func (c *QuoteCache) stream(ctx context.Context) (received bool, err error) {
+	// Пустой список символов - FT отдаёт все активные инструменты
+	stream, err := c.client.StreamQuotes(ctx, &pb.QuoteRequest{})
+	if err != nil {
+		return false, err
+	}
+	for {
+		quote, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		if !received {
+			slog.Info("✅ Поток котировок FT открыт")
+		}
+		received = true
+		c.store(quote)
+	}
+}
+
+// store обновляет кеш и только затем публикует котировку в ленту: подписчик,
+// взявший снимок после подписки, не пропустит ни одной котировки
+func (c *QuoteCache) store(quote *pb.Quote) {
+	now := c.now()
+
+	c.mu.Lock()
+	c.quotes[quote.Symbol] = cachedQuote{quote: quote, receivedAt: now}
+	c.updatedAt = now
+	c.lastErr = nil
+	if !c.connected {
+		c.connected = true
+		upstreamConnected.Set(1)
+	}
+	c.mu.Unlock()
+
+	c.feed.Publish(quote)
+}
+
+func (c *QuoteCache) setDisconnected(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connected = false
+	c.lastErr = err
+	upstreamConnected.Set(0)
+}
+
+// Snapshot возвращает последние котировки. Пока поток открыт, символы без
+// котировок дольше staleAfter (деактивированные в FT) не отдаются; после
+// обрыва отдаются все накопленные котировки со Stale = true.
+func (c *QuoteCache) Snapshot() QuoteSnapshot {
+	now := c.now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	snapshot := QuoteSnapshot{
+		UpdatedAt: c.updatedAt,
+		Stale:     !c.connected || now.Sub(c.updatedAt) > c.staleAfter,
+		Err:       c.lastErr,
+	}
+	snapshot.Quotes = make([]*pb.Quote, 0, len(c.quotes))
+	for _, cached := range c.quotes {
+		if c.connected && !snapshot.Stale && now.Sub(cached.receivedAt) > c.staleAfter {
+			continue
+		}
+		snapshot.Quotes = append(snapshot.Quotes, cached.quote)
+	}
+	sort.Slice(snapshot.Quotes, func(i, j int) bool {
+		return snapshot.Quotes[i].Symbol < snapshot.Quotes[j].Symbol
+	})
+	return snapshot
+}
+
+// jitter случайная пауза в [d/2, d], чтобы HT не переподключались синхронно
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
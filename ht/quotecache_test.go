@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	pb "ft-mt/proto"
+)
+
+// fakeFT отдаёт котировки и обрывает поток по команде
+type fakeFT struct {
+	pb.UnimplementedQuoteServiceServer
+	quotes []*pb.Quote
+	calls  atomic.Int32
+
+	candles   []*pb.Candle // Снимок StreamCandles
+	candleErr error        // Ошибка после снимка вместо live-обновлений
+
+	mu   sync.Mutex
+	drop chan struct{} // Закрытие обрывает открытые потоки с UNAVAILABLE
+}
+
+func newFakeFT(quotes ...*pb.Quote) *fakeFT {
+	return &fakeFT{quotes: quotes, drop: make(chan struct{})}
+}
+
+// dropStreams обрывает открытые потоки; следующие подключения работают как обычно
+func (f *fakeFT) dropStreams() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.drop)
+	f.drop = make(chan struct{})
+}
+
+func (f *fakeFT) StreamQuotes(req *pb.QuoteRequest, stream pb.QuoteService_StreamQuotesServer) error {
+	f.calls.Add(1)
+	f.mu.Lock()
+	drop := f.drop
+	f.mu.Unlock()
+
+	for _, quote := range f.quotes {
+		if err := stream.Send(quote); err != nil {
+			return err
+		}
+	}
+	select {
+	case <-stream.Context().Done():
+		return stream.Context().Err()
+	case <-drop:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+}
+
+// ListSymbols отдаёт символы котировок fakeFT
+func (f *fakeFT) ListSymbols(ctx context.Context, req *pb.ListSymbolsRequest) (*pb.ListSymbolsResponse, error) {
+	resp := &pb.ListSymbolsResponse{}
+	for _, quote := range f.quotes {
+		resp.Symbols = append(resp.Symbols, &pb.SymbolInfo{Symbol: quote.Symbol})
+	}
+	return resp, nil
+}
+
+// startFakeFT запускает fakeFT и возвращает клиента к нему
+func startFakeFT(t *testing.T, ft *fakeFT) pb.QuoteServiceClient {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterQuoteServiceServer(server, ft)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewQuoteServiceClient(conn)
+}
+
+// waitFor ждёт выполнения условия не дольше 2 секунд
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Не дождались: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQuoteCacheReconnects(t *testing.T) {
+	ft := newFakeFT(&pb.Quote{Symbol: "SBER", Price: 250}, &pb.Quote{Symbol: "BTC", Price: 50000})
+	cache := NewQuoteCache(startFakeFT(t, ft), time.Minute, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cache.Run(ctx)
+
+	waitFor(t, "котировки в кеше", func() bool { return len(cache.Snapshot().Quotes) == 2 })
+	snapshot := cache.Snapshot()
+	if snapshot.Stale {
+		t.Error("Кеш с открытым потоком не должен быть stale")
+	}
+	if snapshot.Quotes[0].Symbol != "BTC" || snapshot.Quotes[1].Symbol != "SBER" {
+		t.Errorf("Котировки должны идти по алфавиту, получено %v", snapshot.Quotes)
+	}
+
+	// Обрыв: котировки остаются, но помечены stale
+	ft.dropStreams()
+	waitFor(t, "stale после обрыва", func() bool { return cache.Snapshot().Stale })
+	if snapshot := cache.Snapshot(); len(snapshot.Quotes) != 2 || snapshot.Err == nil {
+		t.Errorf("После обрыва ожидались 2 котировки и ошибка, получено %d, %v", len(snapshot.Quotes), snapshot.Err)
+	}
+
+	// После паузы кеш переподключается и снова свежий
+	waitFor(t, "переподключение", func() bool { return ft.calls.Load() == 2 && !cache.Snapshot().Stale })
+}
+
+func TestQuoteCacheStaleness(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cache := NewQuoteCache(nil, 5*time.Second, time.Second)
+	cache.now = func() time.Time { return now }
+
+	if snapshot := cache.Snapshot(); !snapshot.Stale || len(snapshot.Quotes) != 0 {
+		t.Errorf("Пустой кеш должен быть stale, получено %+v", snapshot)
+	}
+
+	cache.store(&pb.Quote{Symbol: "BTC"})
+	now = now.Add(3 * time.Second)
+	cache.store(&pb.Quote{Symbol: "ETH"})
+	now = now.Add(3 * time.Second)
+
+	// BTC не обновлялся дольше staleAfter - символ больше не публикуется
+	snapshot := cache.Snapshot()
+	if snapshot.Stale || len(snapshot.Quotes) != 1 || snapshot.Quotes[0].Symbol != "ETH" {
+		t.Errorf("Ожидалась только свежая ETH, получено stale=%v %v", snapshot.Stale, snapshot.Quotes)
+	}
+
+	// Котировки не приходят совсем - весь кеш stale, но отдаётся целиком
+	now = now.Add(10 * time.Second)
+	if snapshot := cache.Snapshot(); !snapshot.Stale || len(snapshot.Quotes) != 2 {
+		t.Errorf("Ожидались 2 stale котировки, получено stale=%v %v", snapshot.Stale, snapshot.Quotes)
+	}
+}
+
+func TestQuotesHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.UnixMilli(1700000000000)
+	cache := NewQuoteCache(nil, 5*time.Second, time.Second)
+	cache.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.GET("/quotes", quotesHandler(cache))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/quotes", nil))
+		return w
+	}
+
+	w := get()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get(quotesStaleHeader) != "true" {
+		t.Errorf("Пустой кеш: ожидался 503 со stale, получено %d %v", w.Code, w.Header())
+	}
+
+	cache.store(&pb.Quote{Symbol: "BTC", Price: 50000})
+	w = get()
+	if w.Code != http.StatusOK || w.Header().Get(quotesStaleHeader) != "false" ||
+		w.Header().Get(quotesUpdatedAtHeader) != strconv.FormatInt(now.UnixMilli(), 10) {
+		t.Errorf("Ожидался 200 со свежими котировками, получено %d %v", w.Code, w.Header())
+	}
+	// Тело - массив котировок, как до кеша
+	var quotes []map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &quotes); err != nil || len(quotes) != 1 || quotes[0]["symbol"] != "BTC" {
+		t.Errorf("Ожидался массив из 1 котировки, получено %s (%v)", w.Body, err)
+	}
+
+	cache.setDisconnected(status.Error(codes.Unavailable, "down"))
+	if w := get(); w.Code != http.StatusOK || w.Header().Get(quotesStaleHeader) != "true" {
+		t.Errorf("После обрыва ожидался 200 со stale, получено %d %v", w.Code, w.Header())
+	}
+}
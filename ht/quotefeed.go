@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "ft-mt/proto"
+)
+
+const (
+	// defaultFeedHistory сколько последних котировок хранится для возобновления по Last-Event-ID
+	defaultFeedHistory = 1024
+	// feedSubscriberBuffer буфер котировок одного подписчика (SSE или WebSocket)
+	feedSubscriberBuffer = 256
+)
+
+// QuoteEvent котировка с порядковым номером в ленте
+type QuoteEvent struct {
+	Seq   uint64
+	Quote *pb.Quote
+}
+
+// FeedSubscriber подписка на ленту. Канал C закрывается, если клиент не
+// успевает читать или лента закрыта; клиент может продолжить с последнего
+// полученного номера.
+type FeedSubscriber struct {
+	C       <-chan QuoteEvent
+	ch      chan QuoteEvent
+	symbols map[string]bool // nil = все символы
+	slow    bool            // Отключён за отставание, а не закрытием ленты
+}
+
+// Slow true, если канал закрыт из-за того, что клиент не успевал читать.
+// Имеет смысл только после закрытия C.
+func (sub *FeedSubscriber) Slow() bool {
+	return sub.slow
+}
+
+func (sub *FeedSubscriber) wants(symbol string) bool {
+	return sub.symbols == nil || sub.symbols[symbol]
+}
+
+// QuoteFeed нумерует котировки из FT, раздаёт их подписчикам и хранит
+// последние history котировок, чтобы переподключившийся клиент получил
+// пропущенное. Номера начинаются заново при каждом запуске HT, поэтому
+// в ID события входит epoch - время запуска ленты.
+type QuoteFeed struct {
+	epoch int64
+
+	mu          sync.Mutex
+	seq         uint64
+	history     []QuoteEvent // Кольцевой буфер
+	next        int          // Позиция следующей записи в history
+	subscribers map[*FeedSubscriber]struct{}
+	closed      bool
+}
+
+// NewQuoteFeed создаёт ленту, хранящую size последних котировок
+func NewQuoteFeed(size int) *QuoteFeed {
+	return &QuoteFeed{
+		epoch:       time.Now().UnixMilli(),
+		history:     make([]QuoteEvent, 0, size),
+		subscribers: make(map[*FeedSubscriber]struct{}),
+	}
+}
+
+// Publish присваивает котировке следующий номер и рассылает подписчикам
+func (f *QuoteFeed) Publish(quote *pb.Quote) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	event := QuoteEvent{Seq: f.seq, Quote: quote}
+	if len(f.history) < cap(f.history) {
+		f.history = append(f.history, event)
+	} else if cap(f.history) > 0 {
+		f.history[f.next] = event
+		f.next = (f.next + 1) % cap(f.history)
+	}
+
+	for sub := range f.subscribers {
+		if !sub.wants(quote.Symbol) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			// Клиент отстал: отключаем, он догонит по Last-Event-ID
+			sub.slow = true
+			f.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe регистрирует подписчика на символы (пустой список = все).
+// Если lastID указывает на событие этой ленты, которое ещё есть в истории,
+// backlog содержит все следующие за ним котировки и resumed = true;
+// иначе клиенту нужен снимок текущих котировок, а seq - номер, на котором
+// этот снимок актуален. Регистрация и выборка атомарны: между backlog и
+// живыми событиями ничего не теряется.
+func (f *QuoteFeed) Subscribe(symbols []string, lastID string) (sub *FeedSubscriber, backlog []QuoteEvent, seq uint64, resumed bool) {
+	var set map[string]bool
+	if len(symbols) > 0 {
+		set = symbolSet(symbols)
+	}
+	sub = newFeedSubscriber(set)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.addLocked(sub) {
+		return sub, nil, f.seq, false
+	}
+
+	last, ok := f.parseID(lastID)
+	if !ok || last > f.seq || last+1 < f.oldestLocked() {
+		return sub, nil, f.seq, false
+	}
+	for _, event := range f.orderedLocked() {
+		if event.Seq > last && sub.wants(event.Quote.Symbol) {
+			backlog = append(backlog, event)
+		}
+	}
+	return sub, backlog, f.seq, true
+}
+
+// SubscribeSymbols регистрирует подписчика на точный набор символов без
+// истории: пустой список - ни одного. Набор меняется через SetSymbols.
+func (f *QuoteFeed) SubscribeSymbols(symbols []string) *FeedSubscriber {
+	sub := newFeedSubscriber(symbolSet(symbols))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addLocked(sub)
+	return sub
+}
+
+// SetSymbols заменяет набор символов подписчика. Котировки, уже лежащие
+// в буфере, не отзываются.
+func (f *QuoteFeed) SetSymbols(sub *FeedSubscriber, symbols []string) {
+	set := symbolSet(symbols)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub.symbols = set
+}
+
+func newFeedSubscriber(symbols map[string]bool) *FeedSubscriber {
+	ch := make(chan QuoteEvent, feedSubscriberBuffer)
+	return &FeedSubscriber{C: ch, ch: ch, symbols: symbols}
+}
+
+// addLocked регистрирует подписчика; в закрытой ленте сразу закрывает его канал
+func (f *QuoteFeed) addLocked(sub *FeedSubscriber) bool {
+	if f.closed {
+		close(sub.ch)
+		return false
+	}
+	f.subscribers[sub] = struct{}{}
+	return true
+}
+
+func symbolSet(symbols []string) map[string]bool {
+	set := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		set[symbol] = true
+	}
+	return set
+}
+
+// Unsubscribe удаляет подписчика и закрывает его канал
+func (f *QuoteFeed) Unsubscribe(sub *FeedSubscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removeLocked(sub)
+}
+
+// Close закрывает каналы всех подписчиков и отклоняет новых; вызывается при остановке HT
+func (f *QuoteFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for sub := range f.subscribers {
+		f.removeLocked(sub)
+	}
+}
+
+func (f *QuoteFeed) removeLocked(sub *FeedSubscriber) {
+	if _, ok := f.subscribers[sub]; !ok {
+		return
+	}
+	delete(f.subscribers, sub)
+	close(sub.ch)
+}
+
+// oldestLocked номер самой старой котировки в истории (seq+1, если история пуста)
+func (f *QuoteFeed) oldestLocked() uint64 {
+	if len(f.history) == 0 {
+		return f.seq + 1
+	}
+	if len(f.history) < cap(f.history) {
+		return f.history[0].Seq
+	}
+	return f.history[f.next].Seq
+}
+
+// orderedLocked история от старых котировок к новым
+func (f *QuoteFeed) orderedLocked() []QuoteEvent {
+	if len(f.history) < cap(f.history) {
+		return f.history
+	}
+	return append(f.history[f.next:len(f.history):len(f.history)], f.history[:f.next]...)
+}
+
+// EventID ID события SSE для номера seq: "<epoch>-<seq>"
+func (f *QuoteFeed) EventID(seq uint64) string {
+	return fmt.Sprintf("%d-%d", f.epoch, seq)
+}
+
+// parseID разбирает ID события; ID другой ленты (до перезапуска HT) не подходит
+func (f *QuoteFeed) parseID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != strconv.FormatInt(f.epoch, 10) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
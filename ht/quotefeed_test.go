@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	pb "ft-mt/proto"
+)
+
+func TestQuoteFeedResume(t *testing.T) {
+	feed := NewQuoteFeed(4)
+	for _, symbol := range []string{"BTC", "ETH", "BTC"} {
+		feed.Publish(&pb.Quote{Symbol: symbol})
+	}
+
+	// Продолжение после первой котировки: backlog только по BTC
+	sub, backlog, _, resumed := feed.Subscribe([]string{"BTC"}, feed.EventID(1))
+	defer feed.Unsubscribe(sub)
+	if !resumed || len(backlog) != 1 || backlog[0].Seq != 3 {
+		t.Fatalf("Ожидалось продолжение с котировкой 3, получено resumed=%v %v", resumed, backlog)
+	}
+
+	// Живые котировки фильтруются по символам
+	feed.Publish(&pb.Quote{Symbol: "ETH"})
+	feed.Publish(&pb.Quote{Symbol: "BTC"})
+	if event := <-sub.C; event.Seq != 5 || event.Quote.Symbol != "BTC" {
+		t.Errorf("Ожидалась BTC с номером 5, получено %d %s", event.Seq, event.Quote.Symbol)
+	}
+}
+
+func TestQuoteFeedSnapshotFallback(t *testing.T) {
+	feed := NewQuoteFeed(2)
+	for i := 0; i < 5; i++ {
+		feed.Publish(&pb.Quote{Symbol: "BTC"})
+	}
+
+	for name, lastID := range map[string]string{
+		"без Last-Event-ID":    "",
+		"вытеснено из истории": feed.EventID(1),
+		"номер из будущего":    feed.EventID(10),
+		"другой запуск HT":     "1-4",
+		"некорректный ID":      "garbage",
+	} {
+		sub, backlog, seq, resumed := feed.Subscribe(nil, lastID)
+		if resumed || len(backlog) != 0 || seq != 5 {
+			t.Errorf("%s: ожидался снимок на номере 5, получено resumed=%v seq=%d backlog=%d", name, resumed, seq, len(backlog))
+		}
+		feed.Unsubscribe(sub)
+	}
+
+	// Граница: всё после 3 ещё в истории (4 и 5)
+	sub, backlog, _, resumed := feed.Subscribe(nil, feed.EventID(3))
+	defer feed.Unsubscribe(sub)
+	if !resumed || len(backlog) != 2 || backlog[0].Seq != 4 || backlog[1].Seq != 5 {
+		t.Errorf("Ожидались котировки 4 и 5, получено resumed=%v %v", resumed, backlog)
+	}
+}
+
+func TestQuoteFeedSlowSubscriber(t *testing.T) {
+	feed := NewQuoteFeed(defaultFeedHistory)
+	sub, _, _, _ := feed.Subscribe(nil, "")
+
+	for i := 0; i < feedSubscriberBuffer+1; i++ {
+		feed.Publish(&pb.Quote{Symbol: "BTC"})
+	}
+	for range sub.C {
+	}
+	if !sub.Slow() {
+		t.Error("Отставший подписчик должен быть помечен Slow")
+	}
+	// Канал закрыт - клиент переподключится с Last-Event-ID
+	_, _, _, resumed := feed.Subscribe(nil, feed.EventID(feedSubscriberBuffer))
+	if !resumed {
+		t.Error("Отставший клиент должен продолжить по истории")
+	}
+}
+
+func TestQuoteFeedClose(t *testing.T) {
+	feed := NewQuoteFeed(4)
+	sub, _, _, _ := feed.Subscribe(nil, "")
+	feed.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Error("Close должен закрыть каналы подписчиков")
+	}
+	if sub.Slow() {
+		t.Error("Закрытие ленты - не отставание подписчика")
+	}
+	late, _, _, _ := feed.Subscribe(nil, "")
+	if _, ok := <-late.C; ok {
+		t.Error("После Close новые подписчики должны получать закрытый канал")
+	}
+	feed.Publish(&pb.Quote{Symbol: "BTC"})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"ft-mt/internal/logging"
+	pb "ft-mt/proto"
+)
+
+const (
+	// defaultSSEHeartbeat как часто в простаивающий поток пишется комментарий,
+	// чтобы прокси и балансировщики не закрывали соединение
+	defaultSSEHeartbeat = 15 * time.Second
+	// sseRetry пауза перед переподключением, которую браузер берёт из поля retry
+	sseRetry = 2 * time.Second
+)
+
+// quoteStreamHandler отдаёт котировки как Server-Sent Events. Каждая котировка -
+// событие quote с ID "<epoch>-<seq>". Браузер при переподключении присылает
+// Last-Event-ID и получает пропущенные котировки из истории ленты; если их там
+// уже нет (или HT перезапущен), сначала приходит снимок последних котировок.
+func quoteStreamHandler(cache *QuoteCache, heartbeat time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := logging.FromContext(c.Request.Context())
+		symbols := parseSymbols(c.Query("symbols"))
+
+		sub, backlog, seq, resumed := cache.feed.Subscribe(symbols, c.GetHeader("Last-Event-ID"))
+		defer cache.feed.Unsubscribe(sub)
+
+		header := c.Writer.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		// Nginx не должен буферизовать поток
+		header.Set("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+
+		w := c.Writer
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds()); err != nil {
+			return
+		}
+
+		if resumed {
+			for _, event := range backlog {
+				if err := writeQuoteEvent(w, cache.feed.EventID(event.Seq), event.Quote); err != nil {
+					return
+				}
+			}
+		} else {
+			// Снимок актуален на момент seq: следующие котировки придут из подписки
+			wanted := make(map[string]bool, len(symbols))
+			for _, symbol := range symbols {
+				wanted[symbol] = true
+			}
+			for _, quote := range cache.Snapshot().Quotes {
+				if len(wanted) > 0 && !wanted[quote.Symbol] {
+					continue
+				}
+				if err := writeQuoteEvent(w, cache.feed.EventID(seq), quote); err != nil {
+					return
+				}
+			}
+		}
+		w.Flush()
+		logger.Info("📡 SSE клиент подключён", "symbols", symbols, "resumed", resumed, "backlog", len(backlog))
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				logger.Debug("📡 SSE клиент отключился")
+				return
+			case <-ticker.C:
+				if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				w.Flush()
+			case event, ok := <-sub.C:
+				if !ok {
+					// Клиент отстал или HT останавливается: браузер переподключится сам
+					logger.Info("📡 SSE поток закрыт сервером")
+					return
+				}
+				if err := writeQuoteEvent(w, cache.feed.EventID(event.Seq), event.Quote); err != nil {
+					return
+				}
+				w.Flush()
+			}
+		}
+	}
+}
+
+// writeQuoteEvent пишет одно событие quote
+func writeQuoteEvent(w io.Writer, id string, quote *pb.Quote) error {
+	data, err := json.Marshal(quoteJSON(quote))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: quote\ndata: %s\n\n", id, data)
+	return err
+}
+
+// parseSymbols разбирает список символов "BTC,ETH" (пустая строка - все)
+func parseSymbols(value string) []string {
+	var symbols []string
+	for _, symbol := range strings.Split(value, ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
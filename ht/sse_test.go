@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	pb "ft-mt/proto"
+)
+
+// sseEvent разобранное событие или комментарий SSE
+type sseEvent struct {
+	id, event, data, comment string
+}
+
+// openSSE подключается к /quotes/stream и возвращает канал событий
+func openSSE(t *testing.T, url, lastID string) <-chan sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Ожидался text/event-stream, получено %q", ct)
+	}
+
+	events := make(chan sseEvent, 64)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event != (sseEvent{}) {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, ":"):
+				event.comment = strings.TrimSpace(line[1:])
+			default:
+				field, value, _ := strings.Cut(line, ": ")
+				switch field {
+				case "id":
+					event.id = value
+				case "event":
+					event.event = value
+				case "data":
+					event.data = value
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// nextQuote ждёт следующее событие quote
+func nextQuote(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatal("Поток закрыт")
+			}
+			if event.event == "quote" {
+				return event
+			}
+		case <-timeout:
+			t.Fatal("Не дождались котировки")
+		}
+	}
+}
+
+func TestQuoteStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := NewQuoteCache(nil, time.Minute, time.Second)
+	cache.store(&pb.Quote{Symbol: "BTC", Price: 50000})
+	cache.store(&pb.Quote{Symbol: "ETH", Price: 2500})
+
+	r := gin.New()
+	r.GET("/quotes/stream", quoteStreamHandler(cache, time.Hour))
+	server := httptest.NewServer(r)
+	// Cleanup, а не defer: Close ждёт открытые соединения, их закрывает отмена запросов из openSSE
+	t.Cleanup(server.Close)
+
+	// Первое подключение: снимок только по BTC
+	events := openSSE(t, server.URL+"/quotes/stream?symbols=BTC", "")
+	snapshot := nextQuote(t, events)
+	if !strings.Contains(snapshot.data, `"symbol":"BTC"`) || snapshot.id != cache.feed.EventID(2) {
+		t.Errorf("Ожидался снимок BTC с ID %s, получено %+v", cache.feed.EventID(2), snapshot)
+	}
+
+	cache.store(&pb.Quote{Symbol: "ETH", Price: 2600})
+	cache.store(&pb.Quote{Symbol: "BTC", Price: 51000})
+	live := nextQuote(t, events)
+	if !strings.Contains(live.data, `"price":51000`) || live.id != cache.feed.EventID(4) {
+		t.Errorf("Ожидалась живая BTC с ID %s, получено %+v", cache.feed.EventID(4), live)
+	}
+
+	// Переподключение с Last-Event-ID: только пропущенные котировки
+	cache.store(&pb.Quote{Symbol: "BTC", Price: 52000})
+	resumed := openSSE(t, server.URL+"/quotes/stream?symbols=BTC", live.id)
+	if event := nextQuote(t, resumed); !strings.Contains(event.data, `"price":52000`) {
+		t.Errorf("Ожидалась пропущенная котировка 52000, получено %+v", event)
+	}
+}
+
+func TestQuoteStreamHeartbeat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := NewQuoteCache(nil, time.Minute, time.Second)
+
+	r := gin.New()
+	r.GET("/quotes/stream", quoteStreamHandler(cache, 10*time.Millisecond))
+	server := httptest.NewServer(r)
+	// Cleanup, а не defer: Close ждёт открытые соединения, их закрывает отмена запросов из openSSE
+	t.Cleanup(server.Close)
+
+	events := openSSE(t, server.URL+"/quotes/stream", "")
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.comment == "heartbeat" {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Не дождались heartbeat")
+		}
+	}
+}
+
+func TestParseSymbols(t *testing.T) {
+	if got := parseSymbols(" BTC, ,ETH,"); len(got) != 2 || got[0] != "BTC" || got[1] != "ETH" {
+		t.Errorf("Ожидалось [BTC ETH], получено %v", got)
+	}
+	if got := parseSymbols(""); got != nil {
+		t.Errorf("Пустая строка - все символы, получено %v", got)
+	}
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"ft-mt/internal/logging"
+	pb "ft-mt/proto"
+)
+
+const (
+	// defaultWSMaxSubscriptions сколько символов может быть подписано на одном соединении
+	defaultWSMaxSubscriptions = 50
+	// defaultWSPingInterval как часто сервер шлёт ping; без pong за два интервала соединение закрывается
+	defaultWSPingInterval = 30 * time.Second
+	// defaultWSAuthRecheck как часто токен открытого соединения перепроверяется в auth-service
+	defaultWSAuthRecheck = time.Minute
+	// wsWriteTimeout сколько ждать записи одного сообщения клиенту
+	wsWriteTimeout = 10 * time.Second
+	// wsMaxMessageSize максимальный размер сообщения от клиента
+	wsMaxMessageSize = 4096
+	// wsControlBuffer очередь ответов на управляющие сообщения
+	wsControlBuffer = 16
+)
+
+// Операции клиента и типы сообщений сервера
+const (
+	wsOpSubscribe   = "subscribe"
+	wsOpUnsubscribe = "unsubscribe"
+	wsOpPing        = "ping"
+
+	wsTypeQuote        = "quote"
+	wsTypeSubscribed   = "subscribed"
+	wsTypeUnsubscribed = "unsubscribed"
+	wsTypePong         = "pong"
+	wsTypeError        = "error"
+)
+
+// Коды ошибок в сообщениях error
+const (
+	wsErrBadRequest           = "bad_request"
+	wsErrUnknownSymbols       = "unknown_symbols"
+	wsErrTooManySubscriptions = "too_many_subscriptions"
+	wsErrUnavailable          = "unavailable"
+)
+
+// Метрики WebSocket шлюза
+var (
+	wsConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ht_ws_connections",
+		Help: "Открытые WebSocket соединения.",
+	})
+	wsConflated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ht_ws_conflated_quotes_total",
+		Help: "Котировки, заменённые более свежими до отправки медленному WebSocket клиенту.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(wsConnections, wsConflated)
+}
+
+// wsRequest сообщение клиента: {"op":"subscribe","symbols":["BTC"],"id":"1"}
+type wsRequest struct {
+	ID      string   `json:"id,omitempty"`
+	Op      string   `json:"op"`
+	Symbols []string `json:"symbols"`
+}
+
+// wsMessage сообщение сервера
+type wsMessage struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id,omitempty"`
+	Symbols []string `json:"symbols,omitempty"`
+	Code    string   `json:"code,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Data    gin.H    `json:"data,omitempty"`
+}
+
+// WSConfig настройки WebSocket шлюза
+type WSConfig struct {
+	MaxSubscriptions int
+	PingInterval     time.Duration
+	RequireAuth      bool           // Без валидного токена соединение не принимается
+	Verifier         *TokenVerifier // Проверка токенов; переданный токен проверяется всегда
+	AuthRecheck      time.Duration  // Период перепроверки токена открытого соединения
+}
+
+// wsClose код и причина закрытия соединения сервером
+type wsClose struct {
+	code   int
+	reason string
+}
+
+// Причины закрытия соединения сервером
+var (
+	wsCloseShutdown = wsClose{websocket.CloseGoingAway, "server is shutting down"}
+	wsCloseSlow     = wsClose{websocket.CloseTryAgainLater, "client is too slow"}
+	wsCloseRevoked  = wsClose{websocket.ClosePolicyViolation, "token is no longer valid"}
+)
+
+// WSGateway WebSocket шлюз /ws: клиент управляет подпиской сообщениями
+// subscribe/unsubscribe и получает котировки из общей ленты HT
+type WSGateway struct {
+	cache    *QuoteCache
+	client   pb.QuoteServiceClient
+	cfg      WSConfig
+	upgrader websocket.Upgrader
+}
+
+// NewWSGateway создаёт шлюз поверх кеша котировок; client нужен для проверки символов
+func NewWSGateway(cache *QuoteCache, client pb.QuoteServiceClient, cfg WSConfig) *WSGateway {
+	return &WSGateway{
+		cache:  cache,
+		client: client,
+		cfg:    cfg,
+		upgrader: websocket.Upgrader{
+			// Как и REST API, шлюз открыт для любых origin (CORS *)
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+}
+
+// Handle проверяет токен и переводит соединение на WebSocket
+func (g *WSGateway) Handle(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context())
+
+	token, err := requestToken(c.Request)
+	switch {
+	case errors.Is(err, errNoToken) && !g.cfg.RequireAuth:
+	case err != nil:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	default:
+		claims, err := g.cfg.Verifier.Verify(c.Request.Context(), token)
+		switch {
+		case errors.Is(err, errAuthUnavailable):
+			logger.Error("❌ Не удалось проверить токен в auth-service", "error", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Auth service is unavailable"})
+			return
+		case errors.Is(err, errTokenRevoked):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			return
+		case err != nil:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		logger = logger.With("user_id", claims.UserID)
+	}
+
+	conn, err := g.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrader уже ответил клиенту
+		logger.Warn("⚠️ Не удалось открыть WebSocket", "error", err)
+		return
+	}
+
+	wsConnections.Inc()
+	defer wsConnections.Dec()
+	logger.Info("🔌 WebSocket клиент подключён")
+	newWSSession(g, conn, logger, token).run(c.Request.Context())
+	logger.Info("🔌 WebSocket клиент отключён")
+}
+
+// wsSession одно WebSocket соединение. Читает сообщения клиента в своей
+// горутине, пишет - только writer. Котировки копятся в pending по одной на
+// символ: если клиент не успевает, он получает последние цены, а не очередь.
+type wsSession struct {
+	g      *WSGateway
+	conn   *websocket.Conn
+	logger *slog.Logger
+	token  string // Токен клиента, пусто - анонимное соединение
+	sub    *FeedSubscriber
+
+	control    chan wsMessage // Ответы на сообщения клиента, отправляются раньше котировок
+	ready      chan struct{}  // В pending появились котировки
+	closing    chan wsClose   // Сервер закрывает соединение; первая причина побеждает
+	done       chan struct{}  // Клиент отключился
+	writerDone chan struct{}
+
+	mu      sync.Mutex
+	symbols map[string]bool
+	pending map[string]*pb.Quote
+}
+
+func newWSSession(g *WSGateway, conn *websocket.Conn, logger *slog.Logger, token string) *wsSession {
+	return &wsSession{
+		g:          g,
+		conn:       conn,
+		logger:     logger,
+		token:      token,
+		control:    make(chan wsMessage, wsControlBuffer),
+		ready:      make(chan struct{}, 1),
+		closing:    make(chan wsClose, 1),
+		done:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+		symbols:    make(map[string]bool),
+		pending:    make(map[string]*pb.Quote),
+	}
+}
+
+func (s *wsSession) run(ctx context.Context) {
+	s.sub = s.g.cache.feed.SubscribeSymbols(nil)
+	defer s.g.cache.feed.Unsubscribe(s.sub)
+
+	go s.pump()
+	go s.writer()
+	if s.token != "" {
+		go s.watchToken(ctx)
+	}
+
+	s.reader(ctx)
+	close(s.done)
+	<-s.writerDone
+	s.conn.Close()
+}
+
+// reader обрабатывает сообщения клиента, пока соединение открыто
+func (s *wsSession) reader(ctx context.Context) {
+	pongWait := 2 * s.g.cfg.PingInterval
+	s.conn.SetReadLimit(wsMaxMessageSize)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.Debug("WebSocket соединение прервано", "error", err)
+			}
+			return
+		}
+		// Любое сообщение клиента тоже подтверждает, что он жив
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.send(wsMessage{Type: wsTypeError, Code: wsErrBadRequest, Message: "invalid JSON"})
+			continue
+		}
+		reply, added := s.handle(ctx, req)
+		if !s.send(reply) {
+			return
+		}
+		// Снимок ставится в очередь после ответа и уходит после него
+		if len(added) > 0 {
+			s.enqueueSnapshot(added)
+		}
+	}
+}
+
+// handle применяет сообщение клиента и возвращает ответ на него. Сообщение
+// subscribe с неизвестными символами или сверх лимита отклоняется целиком;
+// added - символы, впервые добавленные в подписку.
+func (s *wsSession) handle(ctx context.Context, req wsRequest) (reply wsMessage, added []string) {
+	reject := func(code, message string, symbols []string) (wsMessage, []string) {
+		return wsMessage{Type: wsTypeError, ID: req.ID, Code: code, Message: message, Symbols: symbols}, nil
+	}
+
+	switch req.Op {
+	case wsOpPing:
+		return wsMessage{Type: wsTypePong, ID: req.ID}, nil
+	case wsOpSubscribe, wsOpUnsubscribe:
+		if len(req.Symbols) == 0 {
+			return reject(wsErrBadRequest, "symbols is required", nil)
+		}
+	default:
+		return reject(wsErrBadRequest, "op must be subscribe, unsubscribe or ping", nil)
+	}
+
+	if req.Op == wsOpUnsubscribe {
+		current := s.unsubscribe(req.Symbols)
+		s.logger.Debug("Подписка WebSocket изменена", "op", req.Op, "symbols", req.Symbols, "current", current)
+		return wsMessage{Type: wsTypeUnsubscribed, ID: req.ID, Symbols: current}, nil
+	}
+
+	unknown, err := s.g.unknownSymbols(ctx, req.Symbols)
+	if err != nil {
+		s.logger.Warn("⚠️ Не удалось проверить символы в FT", "error", err)
+		return reject(wsErrUnavailable, "quote source is unavailable", nil)
+	}
+	if len(unknown) > 0 {
+		return reject(wsErrUnknownSymbols, "unknown symbols", unknown)
+	}
+
+	added, current, ok := s.subscribe(req.Symbols)
+	if !ok {
+		return reject(wsErrTooManySubscriptions,
+			fmt.Sprintf("at most %d symbols per connection", s.g.cfg.MaxSubscriptions), nil)
+	}
+	s.logger.Debug("Подписка WebSocket изменена", "op", req.Op, "symbols", req.Symbols, "current", current)
+	return wsMessage{Type: wsTypeSubscribed, ID: req.ID, Symbols: current}, added
+}
+
+// subscribe добавляет символы, если не превышен лимит; added - символы, которых ещё не было
+func (s *wsSession) subscribe(symbols []string) (added, current []string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, symbol := range symbols {
+		if !s.symbols[symbol] && !slices.Contains(added, symbol) {
+			added = append(added, symbol)
+		}
+	}
+	if len(s.symbols)+len(added) > s.g.cfg.MaxSubscriptions {
+		return nil, nil, false
+	}
+	for _, symbol := range added {
+		s.symbols[symbol] = true
+	}
+	current = s.currentLocked()
+	s.g.cache.feed.SetSymbols(s.sub, current)
+	return added, current, true
+}
+
+// unsubscribe убирает символы (неподписанные игнорируются) вместе с неотправленными котировками
+func (s *wsSession) unsubscribe(symbols []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, symbol := range symbols {
+		delete(s.symbols, symbol)
+		delete(s.pending, symbol)
+	}
+	current := s.currentLocked()
+	s.g.cache.feed.SetSymbols(s.sub, current)
+	return current
+}
+
+func (s *wsSession) currentLocked() []string {
+	current := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		current = append(current, symbol)
+	}
+	sort.Strings(current)
+	return current
+}
+
+// enqueueSnapshot отправляет последние известные котировки новых символов,
+// если живая котировка ещё не пришла
+func (s *wsSession) enqueueSnapshot(symbols []string) {
+	wanted := symbolSet(symbols)
+	s.mu.Lock()
+	for _, quote := range s.g.cache.Snapshot().Quotes {
+		if _, ok := s.pending[quote.Symbol]; wanted[quote.Symbol] && !ok {
+			s.pending[quote.Symbol] = quote
+		}
+	}
+	s.mu.Unlock()
+	s.notify()
+}
+
+// pump перекладывает котировки из ленты в pending, заменяя неотправленные
+func (s *wsSession) pump() {
+	for event := range s.sub.C {
+		s.mu.Lock()
+		if s.symbols[event.Quote.Symbol] {
+			if _, ok := s.pending[event.Quote.Symbol]; ok {
+				wsConflated.Inc()
+			}
+			s.pending[event.Quote.Symbol] = event.Quote
+		}
+		s.mu.Unlock()
+		s.notify()
+	}
+	if s.sub.Slow() {
+		s.logger.Warn("⚠️ WebSocket клиент не успевает читать, соединение закрыто")
+		s.close(wsCloseSlow)
+	} else {
+		s.close(wsCloseShutdown)
+	}
+}
+
+// watchToken раз в AuthRecheck перепроверяет токен: выход, смена пароля, роли
+// или блокировка пользователя закрывают уже открытое соединение. Пока
+// auth-service недоступен, соединение не рвётся, но истёкший токен
+// отклоняется и без него.
+func (s *wsSession) watchToken(ctx context.Context) {
+	ticker := time.NewTicker(s.g.cfg.AuthRecheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		_, err := s.g.cfg.Verifier.Verify(ctx, s.token)
+		switch {
+		case err == nil:
+		case errors.Is(err, errAuthUnavailable):
+			s.logger.Warn("⚠️ Не удалось перепроверить токен WebSocket клиента", "error", err)
+		default:
+			s.logger.Info("🔒 Токен WebSocket клиента больше не действует, соединение закрыто", "error", err)
+			s.close(wsCloseRevoked)
+			return
+		}
+	}
+}
+
+// close просит writer закрыть соединение с причиной; повторные вызовы игнорируются
+func (s *wsSession) close(reason wsClose) {
+	select {
+	case s.closing <- reason:
+	default:
+	}
+}
+
+func (s *wsSession) notify() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// takePending забирает накопленные котировки по алфавиту символов
+func (s *wsSession) takePending() []*pb.Quote {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	quotes := make([]*pb.Quote, 0, len(s.pending))
+	for _, quote := range s.pending {
+		quotes = append(quotes, quote)
+	}
+	clear(s.pending)
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Symbol < quotes[j].Symbol })
+	return quotes
+}
+
+// send ставит ответ в очередь writer; false - соединение уже закрывается
+func (s *wsSession) send(msg wsMessage) bool {
+	select {
+	case s.control <- msg:
+		return true
+	case <-s.writerDone:
+		return false
+	}
+}
+
+// writer единственный, кто пишет в соединение: ответы, котировки и ping
+func (s *wsSession) writer() {
+	defer close(s.writerDone)
+	// Ошибка записи должна прервать и ReadMessage в reader
+	defer s.conn.Close()
+
+	ticker := time.NewTicker(s.g.cfg.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case msg := <-s.control:
+			if s.write(msg) != nil {
+				return
+			}
+		case <-s.ready:
+			if s.flushControl() != nil {
+				return
+			}
+			for _, quote := range s.takePending() {
+				if s.write(wsMessage{Type: wsTypeQuote, Data: quoteJSON(quote)}) != nil {
+					return
+				}
+			}
+		case <-ticker.C:
+			if s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)) != nil {
+				return
+			}
+		case reason := <-s.closing:
+			s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(reason.code, reason.reason),
+				time.Now().Add(wsWriteTimeout))
+			return
+		}
+	}
+}
+
+// flushControl отправляет ответы, поставленные в очередь до котировок
+func (s *wsSession) flushControl() error {
+	for {
+		select {
+		case msg := <-s.control:
+			if err := s.write(msg); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// write пишет сообщение; клиент, не принявший его за wsWriteTimeout, отключается
+func (s *wsSession) write(msg wsMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	err := s.conn.WriteJSON(msg)
+	if err != nil {
+		s.logger.Debug("Ошибка отправки в WebSocket", "error", err)
+	}
+	return err
+}
+
+// unknownSymbols символы, которых нет среди активных инструментов FT
+func (g *WSGateway) unknownSymbols(ctx context.Context, symbols []string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	resp, err := g.client.ListSymbols(ctx, &pb.ListSymbolsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(resp.Symbols))
+	for _, info := range resp.Symbols {
+		known[info.Symbol] = true
+	}
+
+	var unknown []string
+	for _, symbol := range symbols {
+		if !known[symbol] && !slices.Contains(unknown, symbol) {
+			unknown = append(unknown, symbol)
+		}
+	}
+	return unknown, nil
+}
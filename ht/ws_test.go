@@ -0,0 +1,250 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	pb "ft-mt/proto"
+)
+
+// startWSGateway поднимает /ws поверх кеша с fakeFT, знающим BTC, ETH и SBER
+func startWSGateway(t *testing.T, cfg WSConfig) (*QuoteCache, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ft := newFakeFT(&pb.Quote{Symbol: "BTC"}, &pb.Quote{Symbol: "ETH"}, &pb.Quote{Symbol: "SBER"})
+	client := startFakeFT(t, ft)
+	cache := NewQuoteCache(client, time.Minute, time.Second)
+
+	if cfg.MaxSubscriptions == 0 {
+		cfg.MaxSubscriptions = defaultWSMaxSubscriptions
+	}
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = time.Minute
+	}
+	if cfg.Verifier == nil {
+		cfg.Verifier = NewTokenVerifier("secret", "")
+	}
+	if cfg.AuthRecheck == 0 {
+		cfg.AuthRecheck = time.Minute
+	}
+
+	r := gin.New()
+	r.GET("/ws", NewWSGateway(cache, client, cfg).Handle)
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return cache, "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+func dialWS(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, req wsRequest) {
+	t.Helper()
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readWS читает следующее сообщение сервера не дольше 2 секунд
+func readWS(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Не дождались сообщения: %v", err)
+	}
+	return msg
+}
+
+func TestWSSubscribe(t *testing.T) {
+	cache, url := startWSGateway(t, WSConfig{})
+	cache.store(&pb.Quote{Symbol: "BTC", Price: 50000})
+	conn := dialWS(t, url)
+
+	// Подтверждение приходит раньше снимка
+	sendWS(t, conn, wsRequest{ID: "1", Op: wsOpSubscribe, Symbols: []string{"BTC", "ETH"}})
+	if msg := readWS(t, conn); msg.Type != wsTypeSubscribed || msg.ID != "1" || len(msg.Symbols) != 2 {
+		t.Fatalf("Ожидалось подтверждение подписки, получено %+v", msg)
+	}
+	if msg := readWS(t, conn); msg.Type != wsTypeQuote || msg.Data["symbol"] != "BTC" || msg.Data["price"] != float64(50000) {
+		t.Fatalf("Ожидался снимок BTC, получено %+v", msg)
+	}
+
+	// Живые котировки только по подписанным символам
+	cache.store(&pb.Quote{Symbol: "SBER", Price: 250})
+	cache.store(&pb.Quote{Symbol: "ETH", Price: 3000})
+	if msg := readWS(t, conn); msg.Type != wsTypeQuote || msg.Data["symbol"] != "ETH" {
+		t.Fatalf("Ожидалась котировка ETH, получено %+v", msg)
+	}
+
+	sendWS(t, conn, wsRequest{ID: "2", Op: wsOpUnsubscribe, Symbols: []string{"ETH"}})
+	if msg := readWS(t, conn); msg.Type != wsTypeUnsubscribed || len(msg.Symbols) != 1 || msg.Symbols[0] != "BTC" {
+		t.Fatalf("Ожидалась отписка от ETH, получено %+v", msg)
+	}
+	cache.store(&pb.Quote{Symbol: "ETH", Price: 3100})
+	cache.store(&pb.Quote{Symbol: "BTC", Price: 51000})
+	if msg := readWS(t, conn); msg.Data["symbol"] != "BTC" {
+		t.Fatalf("После отписки ожидалась только BTC, получено %+v", msg)
+	}
+
+	sendWS(t, conn, wsRequest{ID: "3", Op: wsOpPing})
+	if msg := readWS(t, conn); msg.Type != wsTypePong || msg.ID != "3" {
+		t.Fatalf("Ожидался pong, получено %+v", msg)
+	}
+}
+
+func TestWSErrors(t *testing.T) {
+	_, url := startWSGateway(t, WSConfig{MaxSubscriptions: 2})
+	conn := dialWS(t, url)
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readWS(t, conn); msg.Type != wsTypeError || msg.Code != wsErrBadRequest {
+		t.Errorf("Невалидный JSON: ожидалась bad_request, получено %+v", msg)
+	}
+
+	sendWS(t, conn, wsRequest{Op: "stream"})
+	if msg := readWS(t, conn); msg.Code != wsErrBadRequest {
+		t.Errorf("Неизвестная операция: ожидалась bad_request, получено %+v", msg)
+	}
+
+	sendWS(t, conn, wsRequest{ID: "1", Op: wsOpSubscribe, Symbols: []string{"BTC", "DOGE"}})
+	msg := readWS(t, conn)
+	if msg.Code != wsErrUnknownSymbols || msg.ID != "1" || len(msg.Symbols) != 1 || msg.Symbols[0] != "DOGE" {
+		t.Errorf("Ожидалась unknown_symbols с DOGE, получено %+v", msg)
+	}
+
+	// Лимит считается по уникальным символам, повторная подписка не тратит его
+	sendWS(t, conn, wsRequest{Op: wsOpSubscribe, Symbols: []string{"BTC", "ETH", "BTC"}})
+	if msg := readWS(t, conn); msg.Type != wsTypeSubscribed || len(msg.Symbols) != 2 {
+		t.Errorf("Ожидалась подписка на 2 символа, получено %+v", msg)
+	}
+	sendWS(t, conn, wsRequest{Op: wsOpSubscribe, Symbols: []string{"ETH"}})
+	if msg := readWS(t, conn); msg.Type != wsTypeSubscribed {
+		t.Errorf("Повторная подписка должна пройти, получено %+v", msg)
+	}
+	sendWS(t, conn, wsRequest{Op: wsOpSubscribe, Symbols: []string{"SBER"}})
+	if msg := readWS(t, conn); msg.Code != wsErrTooManySubscriptions {
+		t.Errorf("Ожидалась too_many_subscriptions, получено %+v", msg)
+	}
+}
+
+func TestWSAuth(t *testing.T) {
+	_, url := startWSGateway(t, WSConfig{RequireAuth: true})
+
+	for name, target := range map[string]string{
+		"без токена":         url,
+		"невалидный токен":   url + "?token=garbage",
+		"токен чужого ключа": url + "?token=" + signToken(t, "other", accessTokenIssuer, time.Now().Add(time.Hour)),
+	} {
+		_, resp, err := websocket.DefaultDialer.Dial(target, nil)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: ожидался 401, получено %v %v", name, resp, err)
+		}
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + signToken(t, "secret", accessTokenIssuer, time.Now().Add(time.Hour))}}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Валидный токен отклонён: %v", err)
+	}
+	conn.Close()
+}
+
+func TestWSAuthRevoked(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	authURL := startFakeAuth(t, func() int { return int(status.Load()) })
+	_, url := startWSGateway(t, WSConfig{
+		RequireAuth: true,
+		Verifier:    NewTokenVerifier("secret", authURL),
+		AuthRecheck: 20 * time.Millisecond,
+	})
+	target := url + "?token=" + signToken(t, "secret", accessTokenIssuer, time.Now().Add(time.Hour))
+
+	// Auth-service недоступен - отзыв не проверить, соединение не принимается
+	status.Store(http.StatusBadGateway)
+	if _, resp, err := websocket.DefaultDialer.Dial(target, nil); resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Ожидался 503, получено %v %v", resp, err)
+	}
+	status.Store(http.StatusUnauthorized)
+	if _, resp, err := websocket.DefaultDialer.Dial(target, nil); resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Отозванный токен: ожидался 401, получено %v %v", resp, err)
+	}
+
+	// Отзыв после подключения закрывает соединение с кодом 1008
+	status.Store(http.StatusOK)
+	conn := dialWS(t, target)
+	status.Store(http.StatusUnauthorized)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("Ожидалось закрытие с кодом 1008, получено %v", err)
+	}
+}
+
+func TestWSSessionCloseReason(t *testing.T) {
+	for name, tc := range map[string]struct {
+		close func(feed *QuoteFeed)
+		want  wsClose
+	}{
+		"медленный клиент": {func(feed *QuoteFeed) {
+			for i := 0; i < feedSubscriberBuffer+1; i++ {
+				feed.Publish(&pb.Quote{Symbol: "BTC"})
+			}
+		}, wsCloseSlow},
+		"остановка HT": {(*QuoteFeed).Close, wsCloseShutdown},
+	} {
+		feed := NewQuoteFeed(defaultFeedHistory)
+		s := newWSSession(nil, nil, slog.Default(), "")
+		s.sub = feed.SubscribeSymbols([]string{"BTC"})
+		tc.close(feed)
+
+		// pump дочитывает канал и выбирает причину закрытия
+		s.pump()
+		if got := <-s.closing; got != tc.want {
+			t.Errorf("%s: ожидалось %+v, получено %+v", name, tc.want, got)
+		}
+	}
+}
+
+func TestWSServerPingAndShutdown(t *testing.T) {
+	cache, url := startWSGateway(t, WSConfig{PingInterval: 20 * time.Millisecond})
+	conn := dialWS(t, url)
+
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(data string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// Остановка HT закрывает соединение с кодом 1001; ping обрабатываются во время чтения
+	go func() {
+		<-pinged
+		cache.feed.Close()
+	}()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Ожидалось закрытие с кодом 1001, получено %v", err)
+	}
+}
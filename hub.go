@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	pb "ft-mt/proto"
+)
+
+// SlowPolicy что делать с подписчиком, который не успевает вычитывать буфер
+type SlowPolicy string
+
+const (
+	// PolicyDropOldest выбрасывает самую старую котировку из буфера
+	PolicyDropOldest SlowPolicy = "drop"
+	// PolicyDisconnect отключает подписчика
+	PolicyDisconnect SlowPolicy = "disconnect"
+)
+
+// ParseSlowPolicy разбирает политику из строки конфигурации
+func ParseSlowPolicy(value string) (SlowPolicy, error) {
+	switch policy := SlowPolicy(value); policy {
+	case PolicyDropOldest, PolicyDisconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("неизвестная политика %q (ожидается drop или disconnect)", value)
+	}
+}
+
+// Subscriber подписка на котировки с собственным буфером
+type Subscriber struct {
+	C        <-chan *pb.Quote
+	ch       chan *pb.Quote
+	symbols  map[string]bool // nil = все символы
+	slow     bool
+	finished bool // хаб закрыт (Close): котировок больше не будет
+	internal bool // внутренний потребитель, не отключается политикой disconnect
+}
+
+// wants проверяет, подписан ли подписчик на символ
+func (sub *Subscriber) wants(symbol string) bool {
+	return sub.symbols == nil || sub.symbols[symbol]
+}
+
+// Slow сообщает, был ли подписчик отключён за медленное чтение.
+// Корректно только после закрытия канала C.
+func (sub *Subscriber) Slow() bool {
+	return sub.slow
+}
+
+// Finished сообщает, что канал закрыт потому, что закрыт хаб (конец записи
+// в режиме воспроизведения). Корректно только после закрытия канала C.
+func (sub *Subscriber) Finished() bool {
+	return sub.finished
+}
+
+// Hub раздаёт опубликованные котировки всем подписчикам
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	bufferSize  int
+	policy      SlowPolicy
+	closed      bool
+	active      chan struct{} // Закрывается при первой внешней подписке
+	hasActive   bool
+}
+
+// NewHub создаёт хаб с размером буфера и политикой для медленных подписчиков
+func NewHub(bufferSize int, policy SlowPolicy) *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscriber]struct{}),
+		bufferSize:  bufferSize,
+		policy:      policy,
+		active:      make(chan struct{}),
+	}
+}
+
+// Active закрывается, когда подписывается первый внешний подписчик
+// (внутренние потребители не в счёт)
+func (h *Hub) Active() <-chan struct{} {
+	return h.active
+}
+
+// Subscribe регистрирует подписчика на символы (пустой список = все)
+func (h *Hub) Subscribe(symbols []string) *Subscriber {
+	if len(symbols) == 0 {
+		return h.subscribe(nil, false)
+	}
+	return h.subscribe(symbolSet(symbols), false)
+}
+
+// SubscribeSymbols регистрирует подписчика на точный набор символов:
+// пустой список - ни одного. Набор меняется через SetSymbols.
+func (h *Hub) SubscribeSymbols(symbols []string) *Subscriber {
+	return h.subscribe(symbolSet(symbols), false)
+}
+
+// SubscribeInternal регистрирует внутреннего потребителя всех символов
+// (агрегатор свечей, запись истории). SLOW_SUBSCRIBER_POLICY=disconnect его
+// не отключает: при переполнении буфера выбрасывается самая старая котировка.
+func (h *Hub) SubscribeInternal() *Subscriber {
+	return h.subscribe(nil, true)
+}
+
+func (h *Hub) subscribe(symbols map[string]bool, internal bool) *Subscriber {
+	ch := make(chan *pb.Quote, h.bufferSize)
+	sub := &Subscriber{C: ch, ch: ch, symbols: symbols, internal: internal}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		sub.finished = true
+		close(ch)
+		return sub
+	}
+	h.subscribers[sub] = struct{}{}
+	if !internal && !h.hasActive {
+		h.hasActive = true
+		close(h.active)
+	}
+	return sub
+}
+
+// SetSymbols заменяет набор символов подписчика. Котировки, уже лежащие
+// в буфере, не отзываются.
+func (h *Hub) SetSymbols(sub *Subscriber, symbols []string) {
+	set := symbolSet(symbols)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub.symbols = set
+}
+
+func symbolSet(symbols []string) map[string]bool {
+	set := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		set[symbol] = true
+	}
+	return set
+}
+
+// Unsubscribe удаляет подписчика и закрывает его канал
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(sub)
+}
+
+func (h *Hub) removeLocked(sub *Subscriber) {
+	if _, ok := h.subscribers[sub]; !ok {
+		return
+	}
+	delete(h.subscribers, sub)
+	close(sub.ch)
+}
+
+// Publish отправляет котировку всем подписчикам на её символ, не блокируясь
+func (h *Hub) Publish(quote *pb.Quote) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		if !sub.wants(quote.Symbol) {
+			continue
+		}
+
+		select {
+		case sub.ch <- quote:
+			continue
+		default:
+		}
+
+		// Буфер подписчика заполнен
+		if h.policy == PolicyDisconnect && !sub.internal {
+			slog.Warn("🐢 Подписчик не успевает читать котировки, отключаем")
+			sub.slow = true
+			h.removeLocked(sub)
+			continue
+		}
+
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- quote:
+		default:
+		}
+	}
+}
+
+// PublishWait как Publish, но вместо политики медленных подписчиков ждёт места
+// в буфере каждого: котировки не теряются и никто не отключается. Нужен там,
+// где источник быстрее любого клиента (REPLAY_SPEED=max). Возвращает false,
+// если ctx отменён раньше, чем котировку получили все подписчики.
+func (h *Hub) PublishWait(ctx context.Context, quote *pb.Quote) bool {
+	delivered := make(map[*Subscriber]bool)
+	for {
+		h.mu.Lock()
+		waiting := false
+		for sub := range h.subscribers {
+			if delivered[sub] || !sub.wants(quote.Symbol) {
+				continue
+			}
+			select {
+			case sub.ch <- quote:
+				delivered[sub] = true
+			default:
+				waiting = true
+			}
+		}
+		h.mu.Unlock()
+
+		if !waiting {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// Close завершает раздачу: подписчики дочитывают буфер, затем их каналы
+// закрываются с Finished() = true; новые подписки получают закрытый канал
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		sub.finished = true
+		h.removeLocked(sub)
+	}
+}
+
+// Len возвращает количество подписчиков
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subscribers)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+)
+
+// TestHubFanOut проверяет, что все подписчики получают одинаковые котировки
+func TestHubFanOut(t *testing.T) {
+	hub := NewHub(4, PolicyDropOldest)
+	first := hub.Subscribe(nil)
+	second := hub.Subscribe(nil)
+
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 100})
+
+	for _, sub := range []*Subscriber{first, second} {
+		quote := <-sub.C
+		if quote.Symbol != "BTC" || quote.Price != 100 {
+			t.Errorf("Получена неожиданная котировка %v", quote)
+		}
+	}
+}
+
+// TestHubSymbolFilter проверяет фильтрацию по символам
+func TestHubSymbolFilter(t *testing.T) {
+	hub := NewHub(4, PolicyDropOldest)
+	sub := hub.Subscribe([]string{"ETH"})
+
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 100})
+	hub.Publish(&pb.Quote{Symbol: "ETH", Price: 10})
+
+	if quote := <-sub.C; quote.Symbol != "ETH" {
+		t.Errorf("Ожидалась котировка ETH, получено %s", quote.Symbol)
+	}
+	if len(sub.C) != 0 {
+		t.Errorf("В буфере не должно остаться котировок, осталось %d", len(sub.C))
+	}
+}
+
+// TestHubDropOldest проверяет, что медленный подписчик теряет самые старые котировки
+func TestHubDropOldest(t *testing.T) {
+	hub := NewHub(2, PolicyDropOldest)
+	sub := hub.Subscribe(nil)
+
+	for i := 1; i <= 3; i++ {
+		hub.Publish(&pb.Quote{Symbol: "BTC", Price: float64(i)})
+	}
+
+	if quote := <-sub.C; quote.Price != 2 {
+		t.Errorf("Ожидалась цена 2, получено %.0f", quote.Price)
+	}
+	if quote := <-sub.C; quote.Price != 3 {
+		t.Errorf("Ожидалась цена 3, получено %.0f", quote.Price)
+	}
+}
+
+// TestHubDisconnectSlow проверяет отключение медленного подписчика
+func TestHubDisconnectSlow(t *testing.T) {
+	hub := NewHub(1, PolicyDisconnect)
+	sub := hub.Subscribe(nil)
+
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 1})
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 2})
+
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Fatal("Канал медленного подписчика должен быть закрыт")
+	}
+	if !sub.Slow() {
+		t.Error("Подписчик должен быть помечен как медленный")
+	}
+	if hub.Len() != 0 {
+		t.Errorf("Подписчик должен быть удалён из хаба, осталось %d", hub.Len())
+	}
+
+	// Повторная отписка не должна паниковать
+	hub.Unsubscribe(sub)
+}
+
+// TestHubActiveAndClose проверяет сигнал первого подписчика и закрытие хаба
+func TestHubActiveAndClose(t *testing.T) {
+	hub := NewHub(4, PolicyDropOldest)
+	hub.SubscribeInternal()
+	select {
+	case <-hub.Active():
+		t.Fatal("Внутренний потребитель не должен активировать хаб")
+	default:
+	}
+
+	sub := hub.Subscribe(nil)
+	select {
+	case <-hub.Active():
+	default:
+		t.Fatal("Первый подписчик должен активировать хаб")
+	}
+
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 1})
+	hub.Close()
+	if quote, ok := <-sub.C; !ok || quote.Price != 1 {
+		t.Errorf("После Close буфер должен дочитываться, получено %v, %v", quote, ok)
+	}
+	if _, ok := <-sub.C; ok || !sub.Finished() {
+		t.Error("После буфера канал должен закрыться с Finished")
+	}
+
+	late := hub.Subscribe(nil)
+	if _, ok := <-late.C; ok || !late.Finished() {
+		t.Error("Подписка на закрытый хаб должна сразу получать закрытый канал")
+	}
+}
+
+// TestHubPublishWait проверяет, что PublishWait ждёт места в буфере, а не отключает
+func TestHubPublishWait(t *testing.T) {
+	hub := NewHub(1, PolicyDisconnect)
+	sub := hub.Subscribe(nil)
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 1})
+
+	published := make(chan bool)
+	go func() { published <- hub.PublishWait(context.Background(), &pb.Quote{Symbol: "BTC", Price: 2}) }()
+
+	select {
+	case <-published:
+		t.Fatal("PublishWait не должен завершаться, пока буфер полон")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-sub.C
+	if !<-published {
+		t.Fatal("PublishWait должен доставить котировку")
+	}
+	if quote := <-sub.C; quote.Price != 2 || sub.Slow() {
+		t.Errorf("Ожидалась цена 2 без отключения, получено %v", quote)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 3})
+	cancel()
+	if hub.PublishWait(ctx, &pb.Quote{Symbol: "BTC", Price: 4}) {
+		t.Error("PublishWait с отменённым ctx должен вернуть false")
+	}
+}
+
+// TestHubInternalNotDisconnected проверяет, что внутренний потребитель не
+// отключается политикой disconnect, а теряет самые старые котировки
+func TestHubInternalNotDisconnected(t *testing.T) {
+	hub := NewHub(1, PolicyDisconnect)
+	sub := hub.SubscribeInternal()
+
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 1})
+	hub.Publish(&pb.Quote{Symbol: "BTC", Price: 2})
+
+	if quote, ok := <-sub.C; !ok || quote.Price != 2 {
+		t.Fatalf("Ожидалась цена 2 в открытом канале, получено %v, %v", quote, ok)
+	}
+	if sub.Slow() || hub.Len() != 1 {
+		t.Errorf("Внутренний потребитель не должен отключаться: slow=%v, подписчиков %d", sub.Slow(), hub.Len())
+	}
+}
+
+// TestParseSlowPolicy проверяет разбор политики из конфигурации
+func TestParseSlowPolicy(t *testing.T) {
+	if _, err := ParseSlowPolicy("drop"); err != nil {
+		t.Errorf("drop должна быть валидной политикой: %v", err)
+	}
+	if _, err := ParseSlowPolicy("block"); err == nil {
+		t.Error("block не должна быть валидной политикой")
+	}
+}
+
+// TestHubSetSymbols проверяет подписку на пустой набор и его замену
+func TestHubSetSymbols(t *testing.T) {
+	hub := NewHub(4, PolicyDropOldest)
+	sub := hub.SubscribeSymbols(nil)
+
+	hub.Publish(&pb.Quote{Symbol: "BTC"})
+	if len(sub.C) != 0 {
+		t.Fatal("Подписчик с пустым набором не должен получать котировки")
+	}
+
+	hub.SetSymbols(sub, []string{"ETH"})
+	hub.Publish(&pb.Quote{Symbol: "BTC"})
+	hub.Publish(&pb.Quote{Symbol: "ETH"})
+	if len(sub.C) != 1 || (<-sub.C).Symbol != "ETH" {
+		t.Error("После SetSymbols ожидалась только котировка ETH")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// defaultSpreadBps спред инструмента без явного значения (DEFAULT колонки instruments.spread_bps)
+const defaultSpreadBps = 5
+
+// Instrument описание торгового инструмента из таблицы instruments
+type Instrument struct {
+	Symbol       string
+	Name         string
+	InitialPrice float64
+	Volatility   float64 // В процентах: 0.1 = ±0.1% за тик
+	SpreadBps    float64 // Спред bid/ask в базисных пунктах от цены
+	IsActive     bool
+	Model        string             // Модель цены: uniform, gbm, ou, merton
+	ModelParams  map[string]float64 // Параметры модели, см. NewPriceModel
+}
+
+// InstrumentSource источник списка инструментов
+type InstrumentSource interface {
+	LoadInstruments(ctx context.Context) ([]Instrument, error)
+}
+
+// PostgresInstrumentSource читает инструменты из таблицы instruments
+type PostgresInstrumentSource struct {
+	db *sql.DB
+}
+
+// NewPostgresInstrumentSource создаёт источник инструментов поверх пула БД
+func NewPostgresInstrumentSource(db *sql.DB) *PostgresInstrumentSource {
+	return &PostgresInstrumentSource{db: db}
+}
+
+// LoadInstruments возвращает все инструменты, включая неактивные
+func (p *PostgresInstrumentSource) LoadInstruments(ctx context.Context) ([]Instrument, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT symbol, name, initial_price, COALESCE(volatility, 0.1), COALESCE(spread_bps, 5),
+		       COALESCE(is_active, true), COALESCE(model, 'uniform'), COALESCE(model_params, '{}')
+		FROM instruments ORDER BY symbol
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instruments []Instrument
+	for rows.Next() {
+		var inst Instrument
+		var params []byte
+		if err := rows.Scan(&inst.Symbol, &inst.Name, &inst.InitialPrice, &inst.Volatility, &inst.SpreadBps,
+			&inst.IsActive, &inst.Model, &params); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(params, &inst.ModelParams); err != nil {
+			return nil, fmt.Errorf("model_params для %s: %w", inst.Symbol, err)
+		}
+		instruments = append(instruments, inst)
+	}
+	return instruments, rows.Err()
+}
+
+// defaultInstruments инструменты по умолчанию, если БД недоступна
+func defaultInstruments() []Instrument {
+	return []Instrument{
+		{Symbol: "SBER", Name: "Сбербанк", InitialPrice: 275.50, Volatility: 0.1, SpreadBps: 5, IsActive: true},
+		{Symbol: "BTC", Name: "Bitcoin", InitialPrice: 95400.0, Volatility: 0.1, SpreadBps: 2, IsActive: true},
+		{Symbol: "ETH", Name: "Ethereum", InitialPrice: 2650.20, Volatility: 0.1, SpreadBps: 3, IsActive: true},
+	}
+}
+
+// watchInstruments периодически перечитывает инструменты и применяет изменения
+func watchInstruments(ctx context.Context, e *Engine, source InstrumentSource, interval time.Duration, health *Health) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := refreshInstruments(ctx, e, source)
+			if err != nil {
+				slog.Warn("⚠️ Не удалось обновить инструменты", "error", err)
+			}
+			health.SetSourceError(err)
+		}
+	}
+}
+
+// refreshInstruments загружает инструменты из источника и применяет их к движку
+func refreshInstruments(ctx context.Context, e *Engine, source InstrumentSource) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	instruments, err := source.LoadInstruments(ctx)
+	if err != nil {
+		return err
+	}
+	e.ApplyInstruments(instruments)
+	return nil
+}
+
+// openDB открывает пул соединений с PostgreSQL по переменным DB_*
+func openDB() (*sql.DB, error) {
+	connStr := "host=" + getEnv("DB_HOST", "localhost") +
+		" port=" + getEnv("DB_PORT", "5432") +
+		" user=" + getEnv("DB_USER", "admin") +
+		" password=" + getEnv("DB_PASSWORD", "secret123") +
+		" dbname=" + getEnv("DB_NAME", "quotopia") +
+		" sslmode=disable"
+
+	return sql.Open("postgres", connStr)
+}
+
+// getEnv получить переменную окружения с дефолтным значением
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeInstrumentSource источник инструментов для тестов
+type fakeInstrumentSource struct {
+	instruments []Instrument
+	err         error
+}
+
+func (f *fakeInstrumentSource) LoadInstruments(ctx context.Context) ([]Instrument, error) {
+	return f.instruments, f.err
+}
+
+// TestApplyInstrumentsAddsActive проверяет добавление активных инструментов из БД
+func TestApplyInstrumentsAddsActive(t *testing.T) {
+	server := NewQuoteServer()
+	source := &fakeInstrumentSource{instruments: append(defaultInstruments(),
+		Instrument{Symbol: "AAPL", Name: "Apple Inc.", InitialPrice: 185.50, Volatility: 0.2, IsActive: true},
+		Instrument{Symbol: "GOOGL", Name: "Google", InitialPrice: 142.30, Volatility: 0.2, IsActive: false},
+	)}
+
+	if err := refreshInstruments(context.Background(), server.engine, source); err != nil {
+		t.Fatalf("refreshInstruments() вернул ошибку: %v", err)
+	}
+
+	if price := server.engine.quotes["AAPL"]; price != 185.50 {
+		t.Errorf("Для AAPL ожидалась цена 185.50, получено %.2f", price)
+	}
+	if _, exists := server.engine.quotes["GOOGL"]; exists {
+		t.Error("Неактивный GOOGL не должен стримиться")
+	}
+	if len(server.engine.Symbols()) != 4 {
+		t.Errorf("Ожидалось 4 тикера, получено %v", server.engine.Symbols())
+	}
+}
+
+// TestApplyInstrumentsDeactivates проверяет удаление деактивированных инструментов
+func TestApplyInstrumentsDeactivates(t *testing.T) {
+	server := NewQuoteServer()
+	instruments := defaultInstruments()
+	instruments[0].IsActive = false // SBER
+
+	server.engine.ApplyInstruments(instruments)
+
+	if _, exists := server.engine.quotes["SBER"]; exists {
+		t.Error("SBER должен быть удалён после деактивации")
+	}
+}
+
+// TestApplyInstrumentsKeepsPrice проверяет, что обновление не сбрасывает текущую цену
+func TestApplyInstrumentsKeepsPrice(t *testing.T) {
+	server := NewQuoteServer()
+	server.engine.quotes["BTC"] = 100000.0
+
+	instruments := defaultInstruments()
+	instruments[1].Volatility = 0.5 // BTC
+	server.engine.ApplyInstruments(instruments)
+
+	if price := server.engine.quotes["BTC"]; price != 100000.0 {
+		t.Errorf("Цена BTC не должна сбрасываться, получено %.2f", price)
+	}
+	if vol := server.engine.instruments["BTC"].Volatility; vol != 0.5 {
+		t.Errorf("Ожидалась волатильность 0.5, получено %.2f", vol)
+	}
+
+	instruments[1].InitialPrice = 90000.0
+	server.engine.ApplyInstruments(instruments)
+	if price := server.engine.quotes["BTC"]; price != 90000.0 {
+		t.Errorf("После смены initial_price ожидалась цена 90000, получено %.2f", price)
+	}
+}
+
+// TestRefreshInstrumentsError проверяет, что ошибка источника не меняет набор
+func TestRefreshInstrumentsError(t *testing.T) {
+	server := NewQuoteServer()
+	source := &fakeInstrumentSource{err: errors.New("db down")}
+
+	if err := refreshInstruments(context.Background(), server.engine, source); err == nil {
+		t.Fatal("Ожидалась ошибка от refreshInstruments()")
+	}
+	if len(server.engine.Symbols()) != 3 {
+		t.Errorf("Набор инструментов не должен меняться, получено %v", server.engine.Symbols())
+	}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader HTTP заголовок с request ID: принимается от клиента
+// (например, от nginx) и возвращается в ответе
+const RequestIDHeader = "X-Request-ID"
+
+// quietRoutes маршруты, которые опрашиваются автоматически и логируются на уровне debug
+var quietRoutes = map[string]bool{"/health": true}
+
+// GinMiddleware назначает запросу request ID, кладёт его в контекст запроса
+// и пишет по строке лога на каждый запрос
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		level := slog.LevelInfo
+		switch {
+		case c.Writer.Status() >= 500:
+			level = slog.LevelError
+		case quietRoutes[c.FullPath()]:
+			level = slog.LevelDebug
+		}
+		FromContext(c.Request.Context()).Log(c.Request.Context(), level, "HTTP запрос",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
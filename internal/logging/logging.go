@@ -0,0 +1,115 @@
+// Package logging структурированные логи (log/slog) и request ID для сервисов Quotopia.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Форматы вывода, выбираемые через LOG_FORMAT
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Setup делает slog логгером по умолчанию по переменным окружения:
+//
+//	LOG_LEVEL   debug | info (по умолчанию) | warn | error
+//	LOG_FORMAT  json (по умолчанию) | text
+//
+// Каждая запись содержит поле service. Оставшиеся вызовы пакета log
+// тоже проходят через slog на уровне info.
+func Setup(service string) error {
+	handler, err := newHandler(os.Stdout, getEnv("LOG_LEVEL", "info"), getEnv("LOG_FORMAT", FormatJSON))
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler).With("service", service))
+	return nil
+}
+
+func newHandler(w io.Writer, level, format string) (slog.Handler, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("неизвестный LOG_LEVEL %q (ожидается debug, info, warn или error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	case FormatText:
+		return slog.NewTextHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("неизвестный LOG_FORMAT %q (ожидается json или text)", format)
+	}
+}
+
+// Fatal пишет ошибку и завершает процесс, как log.Fatalf
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type requestIDKey struct{}
+
+// NewRequestID генерирует случайный request ID (32 hex символа)
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		log.Panicf("crypto/rand: %v", err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// WithRequestID кладёт request ID в контекст
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID достаёт request ID из контекста ("" - если его нет)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// FromContext логгер с request_id и trace_id запроса, если они есть в контексте
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		logger = logger.With("trace_id", span.TraceID().String())
+	}
+	return logger
+}
+
+// validRequestID принимает только короткие печатные ID, пришедшие снаружи
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,167 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// captureLogs подменяет логгер по умолчанию на JSON в буфер
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewHandler(t *testing.T) {
+	for _, tt := range []struct {
+		level, format string
+		wantErr       bool
+	}{
+		{"info", "json", false},
+		{"DEBUG", "text", false},
+		{"warn", "JSON", false},
+		{"verbose", "json", true},
+		{"info", "xml", true},
+	} {
+		_, err := newHandler(&bytes.Buffer{}, tt.level, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s/%s: ожидалась ошибка %v, получено %v", tt.level, tt.format, tt.wantErr, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	handler, _ := newHandler(&buf, "info", "json")
+	logger := slog.New(handler)
+	logger.Debug("тик")
+	logger.Info("подключение")
+	if records := decodeLines(t, &buf); len(records) != 1 || records[0]["msg"] != "подключение" {
+		t.Errorf("Debug не должен попадать в лог на уровне info: %v", records)
+	}
+}
+
+func TestGinMiddlewareRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := captureLogs(t, slog.LevelInfo)
+
+	var seen string
+	r := gin.New()
+	r.Use(GinMiddleware())
+	r.GET("/quotes", func(c *gin.Context) {
+		seen = RequestID(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	// ID клиента сохраняется
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/quotes", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	r.ServeHTTP(w, req)
+	if seen != "abc-123" || w.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Ожидался request ID клиента, в контексте %q, в ответе %q", seen, w.Header().Get(RequestIDHeader))
+	}
+	records := decodeLines(t, buf)
+	if len(records) != 1 || records[0]["request_id"] != "abc-123" || records[0]["route"] != "/quotes" {
+		t.Errorf("Неожиданная строка лога: %v", records)
+	}
+
+	// Без заголовка ID генерируется
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/quotes", nil))
+	if len(seen) != 32 || w.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Ожидался сгенерированный request ID, получено %q", seen)
+	}
+}
+
+// requestIDHealth сервер Health, запоминающий request ID из контекста вызова
+type requestIDHealth struct {
+	*health.Server
+	seen chan string
+}
+
+func (h *requestIDHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	h.seen <- RequestID(ctx)
+	return h.Server.Check(ctx, req)
+}
+
+func TestRequestIDOverGRPC(t *testing.T) {
+	captureLogs(t, slog.LevelInfo)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(UnaryServerInterceptor()))
+	srv := &requestIDHealth{Server: health.NewServer(), seen: make(chan string, 1)}
+	healthpb.RegisterHealthServer(server, srv)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := WithRequestID(context.Background(), "req-42")
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-srv.seen; got != "req-42" {
+		t.Errorf("Ожидался request ID клиента, получено %q", got)
+	}
+
+	// Вызов без request ID получает сгенерированный
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-srv.seen; len(got) != 32 {
+		t.Errorf("Ожидался сгенерированный request ID, получено %q", got)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"":                        false,
+		"abc-123":                 true,
+		"has space":               false,
+		"line\nbreak":             false,
+		string(make([]byte, 129)): false,
+	} {
+		if got := validRequestID(id); got != want {
+			t.Errorf("validRequestID(%q) = %v, ожидалось %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP запросы по маршруту, методу и коду ответа.",
+	}, []string{"route", "method", "status"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Длительность HTTP запросов по маршруту, методу и коду ответа.",
+		Buckets: requestBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+func init() {
+	mustRegister(httpRequests, httpDuration)
+}
+
+// GinMiddleware считает запросы и их длительность. Маршрут берётся из
+// шаблона (/candles/:symbol), чтобы число рядов не росло с параметрами.
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := []string{route, c.Request.Method, strconv.Itoa(c.Writer.Status())}
+		httpRequests.WithLabelValues(labels...).Inc()
+		httpDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	serverHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Завершённые gRPC вызовы на сервере по методу и коду статуса.",
+	}, []string{"method", "code"})
+	serverDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Длительность gRPC вызовов на сервере (для стримов - время жизни стрима).",
+		Buckets: requestBuckets,
+	}, []string{"method"})
+	serverActiveStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "grpc_server_active_streams",
+		Help: "Открытые серверные стримы по методу.",
+	}, []string{"method"})
+	serverSendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_msg_send_seconds",
+		Help:    "Время отправки одного сообщения в серверный стрим.",
+		Buckets: sendBuckets,
+	}, []string{"method"})
+	serverSendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_msg_send_errors_total",
+		Help: "Ошибки отправки сообщений в серверный стрим.",
+	}, []string{"method"})
+
+	clientHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_handled_total",
+		Help: "Завершённые gRPC вызовы клиента по методу и коду статуса.",
+	}, []string{"method", "code"})
+)
+
+func init() {
+	mustRegister(serverHandled, serverDuration, serverActiveStreams, serverSendDuration, serverSendErrors, clientHandled)
+}
+
+// UnaryServerInterceptor считает unary вызовы и их длительность
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		serverDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		serverHandled.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor считает открытые стримы, время отправки сообщений и ошибки отправки
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		active := serverActiveStreams.WithLabelValues(info.FullMethod)
+		active.Inc()
+		defer active.Dec()
+
+		start := time.Now()
+		err := handler(srv, &monitoredServerStream{
+			ServerStream: ss,
+			sendDuration: serverSendDuration.WithLabelValues(info.FullMethod),
+			sendErrors:   serverSendErrors.WithLabelValues(info.FullMethod),
+		})
+		serverDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		serverHandled.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// monitoredServerStream замеряет SendMsg серверного стрима
+type monitoredServerStream struct {
+	grpc.ServerStream
+	sendDuration prometheus.Observer
+	sendErrors   prometheus.Counter
+}
+
+func (s *monitoredServerStream) SendMsg(m any) error {
+	start := time.Now()
+	err := s.ServerStream.SendMsg(m)
+	s.sendDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.sendErrors.Inc()
+	}
+	return err
+}
+
+// UnaryClientInterceptor считает unary вызовы клиента по коду статуса
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		clientHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// StreamClientInterceptor считает клиентские стримы: ошибку открытия или
+// статус, с которым стрим завершился при чтении
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			clientHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+			return nil, err
+		}
+		return &monitoredClientStream{ClientStream: cs, method: method}, nil
+	}
+}
+
+// monitoredClientStream фиксирует статус завершения клиентского стрима
+type monitoredClientStream struct {
+	grpc.ClientStream
+	method string
+	done   bool
+}
+
+func (s *monitoredClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && !s.done {
+		s.done = true
+		code := status.Code(err)
+		if errors.Is(err, io.EOF) {
+			code = codes.OK // Стрим штатно закрыт сервером
+		}
+		clientHandled.WithLabelValues(s.method, code.String()).Inc()
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+// Package metrics общие Prometheus-метрики сервисов Quotopia: gRPC
+// интерцепторы для FT и HT, Gin middleware для HT и auth-service и
+// обработчик /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Бакеты для длительности запросов и отправки сообщений, в секундах
+var (
+	requestBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	sendBuckets    = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1}
+)
+
+// Handler обработчик /metrics для реестра по умолчанию
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// mustRegister регистрирует коллекторы в реестре по умолчанию
+func mustRegister(collectors ...prometheus.Collector) {
+	prometheus.MustRegister(collectors...)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServerStream серверный стрим, у которого каждая вторая отправка падает
+type fakeServerStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (f *fakeServerStream) Context() context.Context { return context.Background() }
+
+func (f *fakeServerStream) SendMsg(m any) error {
+	f.sent++
+	if f.sent%2 == 0 {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+// TestStreamServerInterceptor проверяет активные стримы, отправки и код завершения.
+// Счётчики глобальные и накапливаются между запусками (-count), поэтому
+// проверяется прирост
+func TestStreamServerInterceptor(t *testing.T) {
+	const method = "/test.Service/Stream"
+	info := &grpc.StreamServerInfo{FullMethod: method, IsServerStream: true}
+	sendErrors := testutil.ToFloat64(serverSendErrors.WithLabelValues(method))
+	handled := testutil.ToFloat64(serverHandled.WithLabelValues(method, "Unavailable"))
+
+	err := StreamServerInterceptor()(nil, &fakeServerStream{}, info, func(srv any, ss grpc.ServerStream) error {
+		if active := testutil.ToFloat64(serverActiveStreams.WithLabelValues(method)); active != 1 {
+			t.Errorf("Во время вызова ожидался 1 активный стрим, получено %v", active)
+		}
+		ss.SendMsg("a")
+		ss.SendMsg("b")
+		ss.SendMsg("c")
+		return status.Error(codes.Unavailable, "shutting down")
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("Ожидалась ошибка обработчика, получено %v", err)
+	}
+
+	if active := testutil.ToFloat64(serverActiveStreams.WithLabelValues(method)); active != 0 {
+		t.Errorf("После вызова ожидалось 0 активных стримов, получено %v", active)
+	}
+	if errs := testutil.ToFloat64(serverSendErrors.WithLabelValues(method)) - sendErrors; errs != 1 {
+		t.Errorf("Ожидалась 1 ошибка отправки, получено %v", errs)
+	}
+	if n := testutil.ToFloat64(serverHandled.WithLabelValues(method, "Unavailable")) - handled; n != 1 {
+		t.Errorf("Ожидался 1 вызов с кодом Unavailable, получено %v", n)
+	}
+}
+
+// TestUnaryClientInterceptor проверяет учёт ошибок upstream
+func TestUnaryClientInterceptor(t *testing.T) {
+	const method = "/test.Service/Unary"
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.DeadlineExceeded, "timeout")
+	}
+	before := testutil.ToFloat64(clientHandled.WithLabelValues(method, "DeadlineExceeded"))
+
+	UnaryClientInterceptor()(context.Background(), method, nil, nil, nil, invoker)
+	if n := testutil.ToFloat64(clientHandled.WithLabelValues(method, "DeadlineExceeded")) - before; n != 1 {
+		t.Errorf("Ожидался 1 вызов с DeadlineExceeded, получено %v", n)
+	}
+}
+
+// TestGinMiddleware проверяет метки маршрута и отдачу /metrics
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(GinMiddleware())
+	r.GET("/candles/:symbol", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+	r.GET("/metrics", gin.WrapH(Handler()))
+	candles := testutil.ToFloat64(httpRequests.WithLabelValues("/candles/:symbol", "GET", "400"))
+	unmatched := testutil.ToFloat64(httpRequests.WithLabelValues("unmatched", "GET", "404"))
+
+	for _, path := range []string{"/candles/BTC", "/candles/ETH", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("/candles/:symbol", "GET", "400")) - candles; n != 2 {
+		t.Errorf("Ожидалось 2 запроса к /candles/:symbol, получено %v", n)
+	}
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("unmatched", "GET", "404")) - unmatched; n != 1 {
+		t.Errorf("Ожидался 1 запрос без маршрута, получено %v", n)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `http_requests_total{method="GET",route="/candles/:symbol",status="400"} `) {
+		t.Error("В /metrics нет счётчика запросов")
+	}
+}
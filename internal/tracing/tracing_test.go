@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestSetupExporters проверяет выбор экспортёра по OTEL_TRACES_EXPORTER
+func TestSetupExporters(t *testing.T) {
+	for _, tt := range []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{"", false},
+		{ExporterNone, false},
+		{ExporterStdout, false},
+		{"zipkin", true},
+	} {
+		t.Setenv("OTEL_TRACES_EXPORTER", tt.exporter)
+		shutdown, err := Setup(context.Background(), "test")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: ожидалась ошибка %v, получено %v", tt.exporter, tt.wantErr, err)
+			continue
+		}
+		if err == nil {
+			if err := shutdown(context.Background()); err != nil {
+				t.Errorf("%q: shutdown вернул ошибку: %v", tt.exporter, err)
+			}
+		}
+	}
+}
+
+// TestPropagationOverGRPC проверяет, что спан сервера продолжает трейс клиента
+func TestPropagationOverGRPC(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", ExporterNone)
+	if _, err := Setup(context.Background(), "test"); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "GET /quotes")
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	var serverSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind().String() == "server" {
+			serverSpan = span
+		}
+	}
+	if serverSpan == nil {
+		t.Fatal("Спан сервера не записан")
+	}
+	if serverSpan.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Error("Спан сервера должен принадлежать трейсу клиента")
+	}
+}
@@ -1,99 +1,385 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"ft-mt/candles"
+	"ft-mt/internal/logging"
+	"ft-mt/internal/metrics"
+	"ft-mt/internal/tracing"
 	pb "ft-mt/proto"
 
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 // QuoteServer реализует gRPC сервис генерации котировок
 type QuoteServer struct {
 	pb.UnimplementedQuoteServiceServer
-	quotes map[string]float64
+	engine  *Engine
+	hub     *Hub
+	candles *candles.Store
+	ticks   TickStore // nil - история отключена
+	replay  bool      // Котировки воспроизводятся из файла, seed игнорируется
+
+	minInterval time.Duration // Минимальный interval_ms в QuoteRequest
+
+	shutdown     chan struct{} // Закрывается при остановке сервера
+	shutdownOnce sync.Once
 }
 
-// NewQuoteServer создаёт новый сервер с начальными ценами
+// NewQuoteServer создаёт новый сервер с инструментами по умолчанию
 func NewQuoteServer() *QuoteServer {
+	hub := NewHub(256, PolicyDropOldest)
+	engine := NewEngine(hub, 1*time.Second, realClock{}, 0)
+	engine.ApplyInstruments(defaultInstruments())
+	return newQuoteServer(engine, hub)
+}
+
+// newQuoteServer собирает сервер поверх движка и хаба
+func newQuoteServer(engine *Engine, hub *Hub) *QuoteServer {
 	return &QuoteServer{
-		quotes: map[string]float64{
-			"SBER": 275.50,
-			"BTC":  95400.0,
-			"ETH":  2650.20,
-		},
+		engine:  engine,
+		hub:     hub,
+		candles: candles.NewStore(maxCandleHistory),
+
+		minInterval: defaultMinQuoteInterval,
+		shutdown:    make(chan struct{}),
 	}
 }
 
-// StreamQuotes реализует стриминг котировок
+// StreamQuotes реализует стриминг котировок: подписывается на общий Hub,
+// поэтому все клиенты видят одну и ту же последовательность цен.
+// Если в запросе задан seed, клиент получает собственный воспроизводимый поток.
+// Неизвестные тикеры отклоняются до подписки с INVALID_ARGUMENT.
+// interval_ms и mode задают частоту и режим доставки (см. deliver).
 func (s *QuoteServer) StreamQuotes(req *pb.QuoteRequest, stream pb.QuoteService_StreamQuotesServer) error {
-	log.Printf("Новое подключение. Запрошенные символы: %v", req.Symbols)
-
-	// Определяем какие символы отправлять
-	symbols := req.Symbols
-	if len(symbols) == 0 {
-		// Если не указано - отправляем все
-		for symbol := range s.quotes {
-			symbols = append(symbols, symbol)
+	logger := logging.FromContext(stream.Context())
+	logger.Info("Новое подключение", "symbols", req.Symbols, "interval_ms", req.IntervalMs, "mode", req.Mode.String())
+	trace.SpanFromContext(stream.Context()).SetAttributes(
+		attribute.StringSlice("quotes.symbols", req.Symbols),
+		attribute.Int64("quotes.seed", req.Seed),
+		attribute.Int("quotes.interval_ms", int(req.IntervalMs)),
+		attribute.String("quotes.mode", req.Mode.String()),
+	)
+	if err := s.validateSymbols(req.Symbols); err != nil {
+		return err
+	}
+	interval, err := s.deliveryInterval(req)
+	if err != nil {
+		return err
+	}
+
+	seed := req.Seed
+	if seed != 0 && s.replay {
+		logger.Warn("⚠️ Режим воспроизведения, seed игнорируется", "seed", seed)
+		seed = 0
+	}
+
+	hub := s.hub
+	if seed != 0 {
+		hub = NewHub(s.hub.bufferSize, s.hub.policy)
+	}
+
+	sub := hub.Subscribe(req.Symbols)
+	defer hub.Unsubscribe(sub)
+
+	if seed != 0 {
+		logger.Info("🎲 Отдельный поток", "seed", req.Seed)
+		go s.engine.Fork(hub, req.Seed).Run(stream.Context())
+	}
+
+	return s.deliver(stream.Context(), sub, interval, req.Mode, func(quote *pb.Quote) error {
+		// Отправляем котировку в стрим
+		if err := stream.Send(quote); err != nil {
+			logger.Warn("Ошибка отправки", "error", err)
+			return err
 		}
+
+		logger.Debug("Отправлено", "symbol", quote.Symbol, "price", quote.Price)
+		return nil
+	})
+}
+
+// StreamOrderBook стримит стакан инструмента: сначала снимок на depth уровней,
+// затем инкрементальные обновления на каждый тик общего движка цен
+func (s *QuoteServer) StreamOrderBook(req *pb.OrderBookRequest, stream pb.QuoteService_StreamOrderBookServer) error {
+	if err := s.validateSymbol(req.Symbol); err != nil {
+		return err
+	}
+	depth := int(req.Depth)
+	if depth <= 0 {
+		depth = defaultBookDepth
+	}
+	if depth > maxBookDepth {
+		return status.Errorf(codes.InvalidArgument, "depth must not exceed %d", maxBookDepth)
 	}
 
-	// Бесконечный стрим котировок
-	for {
-		for _, symbol := range symbols {
-			oldPrice, exists := s.quotes[symbol]
-			if !exists {
-				log.Printf("Символ %s не найден, пропускаем", symbol)
-				continue
-			}
+	logger := logging.FromContext(stream.Context())
+	logger.Info("Новое подключение к стакану", "symbol", req.Symbol, "depth", depth)
 
-			// Изменяем цену на случайный процент от -0.1% до +0.1%
-			change := (rand.Float64() * 0.002) - 0.001
-			newPrice := oldPrice * (1 + change)
-			s.quotes[symbol] = newPrice
+	sub := s.hub.Subscribe([]string{req.Symbol})
+	defer s.hub.Unsubscribe(sub)
 
-			quote := &pb.Quote{
-				Symbol:    symbol,
-				Price:     newPrice,
-				Timestamp: time.Now().UnixMilli(),
+	// Снимок сразу по последней котировке движка, не дожидаясь следующего тика
+	// (TICK_INTERVAL может быть большим, источник - на паузе). Подписка
+	// оформлена раньше, поэтому тики после снимка не теряются.
+	book := NewOrderBook(req.Symbol, depth, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if quote, ok := s.engine.LastQuote(req.Symbol); ok {
+		if err := stream.Send(book.Update(quote)); err != nil {
+			logger.Warn("Ошибка отправки стакана", "error", err)
+			return err
+		}
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.shutdown:
+			return errShuttingDown
+		case quote, ok := <-sub.C:
+			if !ok {
+				if sub.Slow() {
+					return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+				}
+				if sub.Finished() {
+					return errReplayFinished
+				}
+				return status.Error(codes.Unavailable, "order book stream closed")
 			}
 
-			// Отправляем котировку в стрим
-			if err := stream.Send(quote); err != nil {
-				log.Printf("Ошибка отправки: %v", err)
+			if err := stream.Send(book.Update(quote)); err != nil {
+				logger.Warn("Ошибка отправки стакана", "error", err)
 				return err
 			}
-
-			log.Printf("Отправлено: %s = %.2f", symbol, newPrice)
 		}
-
-		// Пауза между обновлениями
-		time.Sleep(1 * time.Second)
 	}
 }
 
 func main() {
+	seed := flag.Int64("seed", 0, "зерно генератора цен для воспроизводимых прогонов (переопределяет FT_SEED)")
+	healthCheck := flag.Bool("health", false, "проверить grpc.health.v1 запущенного FT на localhost:50051 и выйти")
+	flag.Parse()
+
+	if *healthCheck {
+		if err := probeHealth("localhost:50051"); err != nil {
+			fmt.Fprintf(os.Stderr, "FT unhealthy: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := logging.Setup("ft"); err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка настройки логов: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Контекст фоновых задач: отменяется после остановки gRPC сервера
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if *seed == 0 {
+		if value := getEnv("FT_SEED", ""); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				logging.Fatal("Некорректный FT_SEED", "error", err)
+			}
+			*seed = parsed
+		}
+	}
+	if *seed != 0 {
+		slog.Info("🎲 Детерминированный режим", "seed", *seed)
+	}
+
+	tickInterval, err := time.ParseDuration(getEnv("TICK_INTERVAL", "1s"))
+	if err != nil {
+		logging.Fatal("Некорректный TICK_INTERVAL", "error", err)
+	}
+	bufferSize, err := strconv.Atoi(getEnv("SUBSCRIBER_BUFFER", "256"))
+	if err != nil || bufferSize <= 0 {
+		logging.Fatal("Некорректный SUBSCRIBER_BUFFER", "value", getEnv("SUBSCRIBER_BUFFER", "256"))
+	}
+	policy, err := ParseSlowPolicy(getEnv("SLOW_SUBSCRIBER_POLICY", string(PolicyDropOldest)))
+	if err != nil {
+		logging.Fatal("Некорректный SLOW_SUBSCRIBER_POLICY", "error", err)
+	}
+
+	minInterval, err := time.ParseDuration(getEnv("MIN_QUOTE_INTERVAL", defaultMinQuoteInterval.String()))
+	if err != nil || minInterval <= 0 {
+		logging.Fatal("Некорректный MIN_QUOTE_INTERVAL", "value", getEnv("MIN_QUOTE_INTERVAL", ""))
+	}
+	shutdownTimeout, err := time.ParseDuration(getEnv("SHUTDOWN_TIMEOUT", "10s"))
+	if err != nil {
+		logging.Fatal("Некорректный SHUTDOWN_TIMEOUT", "error", err)
+	}
+
+	hub := NewHub(bufferSize, policy)
+	engine := NewEngine(hub, tickInterval, realClock{}, *seed)
+	engine.ApplyInstruments(defaultInstruments())
+	quoteServer := newQuoteServer(engine, hub)
+	quoteServer.minInterval = minInterval
+
+	// Модели цены из конфигурации перекрывают модели из таблицы instruments
+	if path := getEnv("INSTRUMENTS_CONFIG", ""); path != "" {
+		cfg, err := LoadModelConfig(path)
+		if err != nil {
+			logging.Fatal("Ошибка загрузки INSTRUMENTS_CONFIG", "error", err)
+		}
+		engine.SetModelConfig(cfg)
+		slog.Info("📐 Загружены модели цены", "instruments", len(cfg), "path", path)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, "ft")
+	if err != nil {
+		logging.Fatal("Ошибка настройки трейсинга", "error", err)
+	}
+
+	healthStatus := NewHealth()
+
+	db, err := openDB()
+	if err != nil {
+		logging.Fatal("Ошибка настройки подключения к БД", "error", err)
+	}
+	defer db.Close()
+
+	replayCfg, replay, err := replayConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Ошибка настройки воспроизведения", "error", err)
+	}
+	if replay {
+		// Котировки берутся из записи, генератор цен и инструменты из БД не используются
+		quotes, err := LoadReplayFile(replayCfg.Path)
+		if err != nil {
+			logging.Fatal("Ошибка загрузки REPLAY_FILE", "error", err)
+		}
+		replayer, err := NewReplayer(replayCfg, quotes, realClock{}, hub)
+		if err != nil {
+			logging.Fatal("Ошибка настройки воспроизведения", "error", err)
+		}
+		engine.ApplyInstruments(replayer.Instruments())
+		quoteServer.replay = true
+		slog.Info("⏯️ Воспроизведение", "path", replayCfg.Path, "speed", getEnv("REPLAY_SPEED", "1"))
+		go replayer.Run(ctx)
+	} else {
+		// Загружаем инструменты из БД, при недоступности остаёмся на дефолтных
+		source := NewPostgresInstrumentSource(db)
+		err := refreshInstruments(ctx, engine, source)
+		if err != nil {
+			slog.Warn("⚠️ Инструменты из БД не загружены, используем дефолтные", "error", err)
+		}
+		healthStatus.SetSourceError(err)
+
+		refreshInterval, err := time.ParseDuration(getEnv("INSTRUMENTS_REFRESH_INTERVAL", "10s"))
+		if err != nil {
+			logging.Fatal("Некорректный INSTRUMENTS_REFRESH_INTERVAL", "error", err)
+		}
+		go watchInstruments(ctx, engine, source, refreshInterval, healthStatus)
+
+		// Единый цикл генерации цен для всех подписчиков
+		go engine.Run(ctx)
+	}
+	go quoteServer.aggregateCandles(ctx)
+
+	// История тиков
+	var recorderDone <-chan struct{}
+	ticks, err := openTickStore(db)
+	if err != nil {
+		logging.Fatal("Ошибка настройки хранилища тиков", "error", err)
+	}
+	if ticks != nil {
+		defer ticks.Close()
+		quoteServer.ticks = ticks
+		// Воспроизводимые тики уже записаны, повторно их не сохраняем
+		if !replay {
+			recorderDone, err = startTickRecorder(ctx, ticks, hub)
+			if err != nil {
+				logging.Fatal("Ошибка настройки записи тиков", "error", err)
+			}
+			if err := startTickPruner(ctx, ticks); err != nil {
+				logging.Fatal("Ошибка настройки хранения тиков", "error", err)
+			}
+			slog.Info("💾 История тиков включена", "store", getEnv("TICK_STORE", "none"),
+				"retention", getEnv("TICK_RETENTION", defaultTickRetention.String()))
+		}
+	}
+
 	// Создаём TCP listener
 	listener, err := net.Listen("tcp", ":50051")
 	if err != nil {
-		log.Fatalf("Ошибка создания listener: %v", err)
+		logging.Fatal("Ошибка создания listener", "error", err)
 	}
 
 	// Создаём gRPC сервер
-	grpcServer := grpc.NewServer()
-	quoteServer := NewQuoteServer()
+	grpcServer := grpc.NewServer(
+		// Спаны вызовов продолжают трейс клиента (traceparent из metadata)
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		// Request ID из metadata HT попадает в логи вызова
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), metrics.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), metrics.StreamServerInterceptor()),
+	)
 	pb.RegisterQuoteServiceServer(grpcServer, quoteServer)
+	healthStatus.Register(grpcServer)
+	// Reflection: grpcurl работает без proto файла
+	reflection.Register(grpcServer)
+
+	slog.Info("🚀 FT (Quote Generator) запущен", "addr", ":50051", "symbols", engine.Symbols())
+
+	// Prometheus метрики на отдельном HTTP порту
+	metricsServer := &http.Server{Addr: getEnv("METRICS_ADDR", ":9100"), Handler: metrics.Handler()}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("⚠️ Сервер метрик остановлен", "error", err)
+		}
+	}()
 
-	fmt.Println("🚀 FT (Quote Generator) запущен на порту 50051")
-	fmt.Println("📊 Доступные тикеры:", []string{"SBER", "BTC", "ETH"})
-	fmt.Println("⏳ Ожидание подключений...")
+	// Запускаем сервер и ждём SIGINT/SIGTERM
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Запускаем сервер
-	if err := grpcServer.Serve(listener); err != nil {
-		log.Fatalf("Ошибка запуска сервера: %v", err)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- grpcServer.Serve(listener) }()
+
+	select {
+	case err := <-serveErr:
+		logging.Fatal("Ошибка запуска сервера", "error", err)
+	case <-signals.Done():
+		stop()
+	}
+
+	// Новые подключения больше не принимаются, активные стримы получают UNAVAILABLE
+	slog.Info("🛑 Остановка FT, ожидание завершения вызовов", "timeout", shutdownTimeout.String())
+	healthStatus.Drain()
+	quoteServer.Shutdown()
+	gracefulStop(grpcServer, shutdownTimeout)
+	metricsServer.Close()
+
+	// Останавливаем генерацию цен и дописываем накопленные тики до закрытия БД
+	cancel()
+	if recorderDone != nil {
+		<-recorderDone
+	}
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("⚠️ Не удалось отправить спаны", "error", err)
 	}
+	slog.Info("👋 FT остановлен")
 }
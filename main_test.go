@@ -1,9 +1,58 @@
 package main
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// fakeQuoteStream серверный стрим, складывающий котировки в канал
+type fakeQuoteStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pb.Quote
+}
+
+func newFakeQuoteStream(ctx context.Context) *fakeQuoteStream {
+	return &fakeQuoteStream{ctx: ctx, sent: make(chan *pb.Quote, 100)}
+}
+
+func (f *fakeQuoteStream) Context() context.Context { return f.ctx }
+
+func (f *fakeQuoteStream) Send(quote *pb.Quote) error {
+	f.sent <- quote
+	return nil
+}
+
+// receive читает n котировок из стрима с таймаутом
+func (f *fakeQuoteStream) receive(t *testing.T, n int) []*pb.Quote {
+	t.Helper()
+	quotes := make([]*pb.Quote, 0, n)
+	for len(quotes) < n {
+		select {
+		case quote := <-f.sent:
+			quotes = append(quotes, quote)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Получено %d котировок из %d", len(quotes), n)
+		}
+	}
+	return quotes
+}
+
+// newTestQuoteServer создаёт сервер на управляемых часах
+func newTestQuoteServer(clock Clock) *QuoteServer {
+	hub := NewHub(256, PolicyDropOldest)
+	engine := NewEngine(hub, time.Second, clock, 0)
+	engine.ApplyInstruments(defaultInstruments())
+	return newQuoteServer(engine, hub)
+}
+
 // TestNewQuoteServer проверяет создание нового сервера
 func TestNewQuoteServer(t *testing.T) {
 	server := NewQuoteServer()
@@ -14,13 +63,13 @@ func TestNewQuoteServer(t *testing.T) {
 	}
 
 	// Проверяем, что quotes карта инициализирована
-	if server.quotes == nil {
+	if server.engine.quotes == nil {
 		t.Fatal("quotes карта не инициализирована")
 	}
 
 	// Проверяем, что есть ровно 3 тикера
-	if len(server.quotes) != 3 {
-		t.Errorf("Ожидалось 3 тикера, получено %d", len(server.quotes))
+	if len(server.engine.quotes) != 3 {
+		t.Errorf("Ожидалось 3 тикера, получено %d", len(server.engine.quotes))
 	}
 }
 
@@ -40,7 +89,7 @@ func TestInitialPrices(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.symbol, func(t *testing.T) {
-			price, exists := server.quotes[tt.symbol]
+			price, exists := server.engine.quotes[tt.symbol]
 
 			if !exists {
 				t.Errorf("Тикер %s не найден", tt.symbol)
@@ -58,7 +107,7 @@ func TestInitialPrices(t *testing.T) {
 func TestPriceIsPositive(t *testing.T) {
 	server := NewQuoteServer()
 
-	for symbol, price := range server.quotes {
+	for symbol, price := range server.engine.quotes {
 		if price <= 0 {
 			t.Errorf("Цена для %s должна быть положительной, получено %.2f",
 				symbol, price)
@@ -71,7 +120,7 @@ func TestUnknownSymbol(t *testing.T) {
 	server := NewQuoteServer()
 
 	// Проверяем, что неизвестный символ не существует
-	_, exists := server.quotes["UNKNOWN"]
+	_, exists := server.engine.quotes["UNKNOWN"]
 	if exists {
 		t.Error("Неизвестный символ UNKNOWN не должен существовать")
 	}
@@ -83,8 +132,88 @@ func TestAllSymbolsExist(t *testing.T) {
 	requiredSymbols := []string{"SBER", "BTC", "ETH"}
 
 	for _, symbol := range requiredSymbols {
-		if _, exists := server.quotes[symbol]; !exists {
+		if _, exists := server.engine.quotes[symbol]; !exists {
 			t.Errorf("Обязательный символ %s не найден", symbol)
 		}
 	}
 }
+
+// TestStreamQuotesSeedReproducible проверяет, что стримы с одинаковым seed совпадают
+func TestStreamQuotesSeedReproducible(t *testing.T) {
+	run := func() []*pb.Quote {
+		clock := newFakeClock()
+		server := newTestQuoteServer(clock)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream := newFakeQuoteStream(ctx)
+		go server.StreamQuotes(&pb.QuoteRequest{Seed: 42}, stream)
+		clock.WaitForTickers(t, 1)
+		clock.Advance(3 * time.Second)
+		return stream.receive(t, 9)
+	}
+
+	first, second := run(), run()
+	for i := range first {
+		if first[i].Symbol != second[i].Symbol || first[i].Price != second[i].Price ||
+			first[i].Timestamp != second[i].Timestamp {
+			t.Fatalf("Котировка %d различается: %v != %v", i, first[i], second[i])
+		}
+	}
+}
+
+// fakeOrderBookStream серверный стрим стакана для тестов
+type fakeOrderBookStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *pb.OrderBookUpdate
+}
+
+func (f *fakeOrderBookStream) Context() context.Context { return f.ctx }
+
+func (f *fakeOrderBookStream) Send(update *pb.OrderBookUpdate) error {
+	f.sent <- update
+	return nil
+}
+
+// TestStreamOrderBook проверяет снимок и обновления стакана вокруг цены движка
+func TestStreamOrderBook(t *testing.T) {
+	clock := newFakeClock()
+	server := newTestQuoteServer(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go server.engine.Run(ctx)
+	clock.WaitForTickers(t, 1)
+
+	stream := &fakeOrderBookStream{ctx: ctx, sent: make(chan *pb.OrderBookUpdate, 10)}
+	go server.StreamOrderBook(&pb.OrderBookRequest{Symbol: "ETH", Depth: 3}, stream)
+
+	// Снимок приходит сразу, до первого тика движка
+	var snapshot *pb.OrderBookUpdate
+	select {
+	case snapshot = <-stream.sent:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Снимок стакана не пришёл до тика")
+	}
+	if !snapshot.Snapshot || len(snapshot.Bids) != 3 || snapshot.Symbol != "ETH" {
+		t.Errorf("Ожидался снимок ETH на 3 уровня, получено %v", snapshot)
+	}
+	if bid := snapshot.Bids[0].Price; bid > 2650.2 || bid < 2649 {
+		t.Errorf("Снимок должен строиться вокруг начальной цены 2650.2, лучший bid %v", bid)
+	}
+
+	for server.hub.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+	update := <-stream.sent
+	if update.Snapshot || update.Sequence != 2 {
+		t.Errorf("Ожидалось инкрементальное обновление с sequence=2, получено %v", update)
+	}
+
+	err := server.StreamOrderBook(&pb.OrderBookRequest{Symbol: "UNKNOWN"}, stream)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Для неизвестного символа ожидался InvalidArgument, получено %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ticksGenerated тики, сгенерированные движком или воспроизведённые из записи
+var ticksGenerated = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "ft_ticks_total",
+	Help: "Сгенерированные тики по символу.",
+}, []string{"symbol"})
+
+func init() {
+	prometheus.MustRegister(ticksGenerated)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Названия встроенных моделей цены
+const (
+	ModelUniform = "uniform" // Равномерный шаг ±volatility% (поведение по умолчанию)
+	ModelGBM     = "gbm"     // Геометрическое броуновское движение
+	ModelOU      = "ou"      // Процесс Орнштейна–Уленбека (возврат к среднему)
+	ModelMerton  = "merton"  // Jump-diffusion Мертона
+)
+
+// secondsPerYear параметры GBM/OU/Merton задаются в годовом исчислении
+const secondsPerYear = 365 * 24 * 60 * 60
+
+// PriceModel модель, по которой цена инструмента меняется за шаг dt
+type PriceModel interface {
+	Next(price float64, dt time.Duration, rng *rand.Rand) float64
+}
+
+// UniformModel равномерный шаг в пределах ±Volatility процентов
+type UniformModel struct {
+	Volatility float64 // В процентах
+}
+
+// Next реализует PriceModel
+func (m UniformModel) Next(price float64, dt time.Duration, rng *rand.Rand) float64 {
+	change := (rng.Float64()*2 - 1) * m.Volatility / 100
+	return price * (1 + change)
+}
+
+// GBMModel геометрическое броуновское движение
+type GBMModel struct {
+	Drift float64 // Годовой дрейф μ
+	Sigma float64 // Годовая волатильность σ
+}
+
+// Next реализует PriceModel
+func (m GBMModel) Next(price float64, dt time.Duration, rng *rand.Rand) float64 {
+	t := years(dt)
+	return price * math.Exp((m.Drift-m.Sigma*m.Sigma/2)*t+m.Sigma*math.Sqrt(t)*rng.NormFloat64())
+}
+
+// OUModel процесс Орнштейна–Уленбека: цена возвращается к Mean со скоростью Theta
+type OUModel struct {
+	Theta float64 // Скорость возврата к среднему (в год)
+	Mean  float64 // Долгосрочное среднее
+	Sigma float64 // Волатильность в единицах цены (в год)
+}
+
+// Next реализует PriceModel, используя точную дискретизацию процесса
+func (m OUModel) Next(price float64, dt time.Duration, rng *rand.Rand) float64 {
+	t := years(dt)
+	decay := math.Exp(-m.Theta * t)
+	std := m.Sigma * math.Sqrt(t)
+	if m.Theta > 0 {
+		std = m.Sigma * math.Sqrt((1-decay*decay)/(2*m.Theta))
+	}
+	next := m.Mean + (price-m.Mean)*decay + std*rng.NormFloat64()
+	// Процесс может уйти в минус, цена - нет
+	return math.Max(next, math.SmallestNonzeroFloat64)
+}
+
+// MertonModel GBM с пуассоновскими скачками логнормального размера
+type MertonModel struct {
+	Drift    float64 // Годовой дрейф μ
+	Sigma    float64 // Годовая волатильность диффузии σ
+	Lambda   float64 // Среднее число скачков в год
+	JumpMean float64 // Среднее логарифма скачка
+	JumpStd  float64 // Стандартное отклонение логарифма скачка
+}
+
+// Next реализует PriceModel
+func (m MertonModel) Next(price float64, dt time.Duration, rng *rand.Rand) float64 {
+	t := years(dt)
+	// Компенсация дрейфа, чтобы скачки не смещали ожидаемую доходность
+	k := math.Exp(m.JumpMean+m.JumpStd*m.JumpStd/2) - 1
+	logReturn := (m.Drift-m.Lambda*k-m.Sigma*m.Sigma/2)*t + m.Sigma*math.Sqrt(t)*rng.NormFloat64()
+
+	for jumps := poisson(m.Lambda*t, rng); jumps > 0; jumps-- {
+		logReturn += m.JumpMean + m.JumpStd*rng.NormFloat64()
+	}
+	return price * math.Exp(logReturn)
+}
+
+// years переводит шаг в доли года
+func years(dt time.Duration) float64 {
+	return dt.Seconds() / secondsPerYear
+}
+
+// poisson генерирует число событий с интенсивностью lambda (алгоритм Кнута)
+func poisson(lambda float64, rng *rand.Rand) int {
+	if lambda <= 0 {
+		return 0
+	}
+	limit := math.Exp(-lambda)
+	n := 0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		n++
+	}
+	return n
+}
+
+// NewPriceModel создаёт модель инструмента по названию и параметрам.
+// Отсутствующие параметры берутся по умолчанию.
+func NewPriceModel(inst Instrument) (PriceModel, error) {
+	param := func(name string, def float64) float64 {
+		if value, ok := inst.ModelParams[name]; ok {
+			return value
+		}
+		return def
+	}
+
+	switch inst.Model {
+	case "", ModelUniform:
+		return UniformModel{Volatility: param("volatility", inst.Volatility)}, nil
+	case ModelGBM:
+		return GBMModel{
+			Drift: param("drift", 0),
+			Sigma: param("sigma", 0.2),
+		}, nil
+	case ModelOU:
+		return OUModel{
+			Theta: param("theta", 1),
+			Mean:  param("mean", inst.InitialPrice),
+			Sigma: param("sigma", inst.InitialPrice*0.2),
+		}, nil
+	case ModelMerton:
+		return MertonModel{
+			Drift:    param("drift", 0),
+			Sigma:    param("sigma", 0.2),
+			Lambda:   param("lambda", 10),
+			JumpMean: param("jump_mean", 0),
+			JumpStd:  param("jump_std", 0.05),
+		}, nil
+	default:
+		return nil, fmt.Errorf("неизвестная модель цены %q", inst.Model)
+	}
+}
+
+// ModelSpec модель и параметры инструмента из конфигурации
+type ModelSpec struct {
+	Model  string             `json:"model"`
+	Params map[string]float64 `json:"params"`
+}
+
+// ModelConfig настройки моделей по тикерам, приоритетнее значений из БД
+type ModelConfig map[string]ModelSpec
+
+// LoadModelConfig читает JSON-файл вида {"BTC": {"model": "gbm", "params": {"sigma": 0.6}}}
+func LoadModelConfig(path string) (ModelConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg ModelConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("разбор %s: %w", path, err)
+	}
+	for symbol, spec := range cfg {
+		if _, err := NewPriceModel(Instrument{Model: spec.Model, ModelParams: spec.Params}); err != nil {
+			return nil, fmt.Errorf("%s: %w", symbol, err)
+		}
+	}
+	return cfg, nil
+}
+
+// Apply подменяет модели инструментов, указанных в конфигурации
+func (cfg ModelConfig) Apply(instruments []Instrument) []Instrument {
+	result := make([]Instrument, len(instruments))
+	for i, inst := range instruments {
+		if spec, ok := cfg[inst.Symbol]; ok {
+			inst.Model = spec.Model
+			inst.ModelParams = spec.Params
+		}
+		result[i] = inst
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestGBMDeterministicDrift проверяет, что при σ=0 GBM растёт ровно по дрейфу
+func TestGBMDeterministicDrift(t *testing.T) {
+	model := GBMModel{Drift: 0.1, Sigma: 0}
+	rng := rand.New(rand.NewSource(1))
+
+	got := model.Next(100, secondsPerYear*time.Second, rng)
+	want := 100 * math.Exp(0.1)
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("Ожидалась цена %.6f, получено %.6f", want, got)
+	}
+}
+
+// TestOUMeanReversion проверяет, что OU без шума тянет цену к среднему
+func TestOUMeanReversion(t *testing.T) {
+	model := OUModel{Theta: 100, Mean: 50, Sigma: 0}
+	rng := rand.New(rand.NewSource(1))
+
+	price := 100.0
+	for i := 0; i < 10; i++ {
+		next := model.Next(price, 24*time.Hour, rng)
+		if math.Abs(next-50) >= math.Abs(price-50) {
+			t.Fatalf("Цена должна приближаться к среднему: %.4f -> %.4f", price, next)
+		}
+		price = next
+	}
+}
+
+// TestMertonWithoutJumpsIsGBM проверяет, что Merton без скачков совпадает с GBM
+func TestMertonWithoutJumpsIsGBM(t *testing.T) {
+	merton := MertonModel{Drift: 0.05, Sigma: 0.3}
+	gbm := GBMModel{Drift: 0.05, Sigma: 0.3}
+
+	got := merton.Next(100, time.Hour, rand.New(rand.NewSource(7)))
+	want := gbm.Next(100, time.Hour, rand.New(rand.NewSource(7)))
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("Ожидалась цена %.6f, получено %.6f", want, got)
+	}
+}
+
+// TestPricesStayPositive проверяет, что ни одна модель не уводит цену в ноль и ниже
+func TestPricesStayPositive(t *testing.T) {
+	models := map[string]PriceModel{
+		ModelUniform: UniformModel{Volatility: 5},
+		ModelGBM:     GBMModel{Sigma: 2},
+		ModelOU:      OUModel{Theta: 1, Mean: 1, Sigma: 100},
+		ModelMerton:  MertonModel{Sigma: 2, Lambda: 1000, JumpMean: -0.5, JumpStd: 0.5},
+	}
+	rng := rand.New(rand.NewSource(42))
+
+	for name, model := range models {
+		price := 100.0
+		for i := 0; i < 1000; i++ {
+			price = model.Next(price, time.Hour, rng)
+			if price <= 0 || math.IsNaN(price) {
+				t.Fatalf("%s: некорректная цена %v на шаге %d", name, price, i)
+			}
+		}
+	}
+}
+
+// TestNewPriceModel проверяет выбор модели и параметры по умолчанию
+func TestNewPriceModel(t *testing.T) {
+	model, err := NewPriceModel(Instrument{Model: ModelOU, InitialPrice: 200, ModelParams: map[string]float64{"theta": 5}})
+	if err != nil {
+		t.Fatalf("NewPriceModel() вернул ошибку: %v", err)
+	}
+	ou, ok := model.(OUModel)
+	if !ok {
+		t.Fatalf("Ожидалась OUModel, получено %T", model)
+	}
+	if ou.Theta != 5 || ou.Mean != 200 {
+		t.Errorf("Неверные параметры OU: %+v", ou)
+	}
+
+	if _, err := NewPriceModel(Instrument{Model: "heston"}); err == nil {
+		t.Error("Неизвестная модель должна возвращать ошибку")
+	}
+}
+
+// TestLoadModelConfig проверяет загрузку и применение конфигурации моделей
+func TestLoadModelConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.json")
+	data := `{"BTC": {"model": "merton", "params": {"lambda": 5}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadModelConfig(path)
+	if err != nil {
+		t.Fatalf("LoadModelConfig() вернул ошибку: %v", err)
+	}
+
+	instruments := cfg.Apply(defaultInstruments())
+	for _, inst := range instruments {
+		if inst.Symbol == "BTC" && (inst.Model != ModelMerton || inst.ModelParams["lambda"] != 5) {
+			t.Errorf("Конфигурация не применилась к BTC: %+v", inst)
+		}
+		if inst.Symbol == "ETH" && inst.Model != "" {
+			t.Errorf("ETH не должен меняться, получено %q", inst.Model)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`{"BTC": {"model": "heston"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadModelConfig(path); err == nil {
+		t.Error("Конфигурация с неизвестной моделью должна отклоняться")
+	}
+}
+
+// TestEngineUsesConfiguredModel проверяет, что движок применяет модель из конфигурации
+func TestEngineUsesConfiguredModel(t *testing.T) {
+	engine := NewEngine(NewHub(16, PolicyDropOldest), time.Second, realClock{}, 0)
+	engine.ApplyInstruments(defaultInstruments())
+	engine.SetModelConfig(ModelConfig{"BTC": {Model: ModelGBM, Params: map[string]float64{"sigma": 0.5}}})
+
+	if _, ok := engine.models["BTC"].(GBMModel); !ok {
+		t.Errorf("Для BTC ожидалась GBMModel, получено %T", engine.models["BTC"])
+	}
+	if _, ok := engine.models["ETH"].(UniformModel); !ok {
+		t.Errorf("Для ETH ожидалась UniformModel, получено %T", engine.models["ETH"])
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	pb "ft-mt/proto"
+)
+
+// Ограничения глубины стакана
+const (
+	defaultBookDepth = 10
+	maxBookDepth     = 50
+)
+
+// OrderBook симулированный стакан одного инструмента. Уровни строятся на
+// сетке шага цены вокруг bid/ask котировки, поэтому при небольшом движении
+// цены большинство уровней сохраняется и обновления получаются компактными.
+type OrderBook struct {
+	symbol   string
+	depth    int
+	sequence uint64
+	bids     map[float64]float64 // цена -> объём
+	asks     map[float64]float64
+	rng      *rand.Rand
+}
+
+// NewOrderBook создаёт пустой стакан заданной глубины
+func NewOrderBook(symbol string, depth int, rng *rand.Rand) *OrderBook {
+	return &OrderBook{
+		symbol: symbol,
+		depth:  depth,
+		bids:   make(map[float64]float64),
+		asks:   make(map[float64]float64),
+		rng:    rng,
+	}
+}
+
+// Update перестраивает стакан вокруг котировки. Первый вызов возвращает
+// полный снимок, последующие - только изменившиеся уровни (size = 0 - удалён).
+func (b *OrderBook) Update(quote *pb.Quote) *pb.OrderBookUpdate {
+	tick := tickSize(quote.Price)
+	bestBid := math.Floor(quote.Bid/tick) * tick
+	bestAsk := math.Ceil(quote.Ask/tick) * tick
+	if bestAsk <= bestBid {
+		bestAsk = bestBid + tick
+	}
+
+	bids := b.buildSide(b.bids, bestBid, -tick, quote.BidSize)
+	asks := b.buildSide(b.asks, bestAsk, tick, quote.AskSize)
+
+	b.sequence++
+	update := &pb.OrderBookUpdate{
+		Symbol:    b.symbol,
+		Sequence:  b.sequence,
+		Timestamp: quote.Timestamp,
+		Snapshot:  b.sequence == 1,
+	}
+	if update.Snapshot {
+		update.Bids = levels(bids, true)
+		update.Asks = levels(asks, false)
+	} else {
+		update.Bids = diffLevels(b.bids, bids, true)
+		update.Asks = diffLevels(b.asks, asks, false)
+	}
+
+	b.bids, b.asks = bids, asks
+	return update
+}
+
+// buildSide строит depth уровней от best с шагом step. Объём лучшего уровня
+// берётся из котировки, у сохранившихся уровней объём иногда слегка меняется.
+func (b *OrderBook) buildSide(old map[float64]float64, best, step, bestSize float64) map[float64]float64 {
+	side := make(map[float64]float64, b.depth)
+	for i := 0; i < b.depth; i++ {
+		price := roundToTick(best+float64(i)*step, math.Abs(step))
+		switch size, exists := old[price]; {
+		case i == 0:
+			side[price] = bestSize
+		case exists && b.rng.Float64() < 0.7:
+			side[price] = size
+		default:
+			// Глубже в стакане ликвидности в среднем больше
+			side[price] = math.Ceil(bestSize * (1 + float64(i)*0.5) * (0.5 + b.rng.Float64()))
+		}
+	}
+	return side
+}
+
+// tickSize шаг цены: 4 значащие цифры до запятой (95400 -> 1, 2650 -> 0.1, 275 -> 0.01)
+func tickSize(price float64) float64 {
+	if price <= 0 {
+		return 0.01
+	}
+	return math.Pow(10, math.Floor(math.Log10(price))-4)
+}
+
+// roundToTick убирает погрешность float при шаге сетки
+func roundToTick(price, tick float64) float64 {
+	return math.Round(price/tick) * tick
+}
+
+// levels сортирует уровни стороны стакана
+func levels(side map[float64]float64, descending bool) []*pb.PriceLevel {
+	result := make([]*pb.PriceLevel, 0, len(side))
+	for price, size := range side {
+		result = append(result, &pb.PriceLevel{Price: price, Size: size})
+	}
+	sortLevels(result, descending)
+	return result
+}
+
+// diffLevels возвращает изменившиеся и удалённые уровни
+func diffLevels(old, current map[float64]float64, descending bool) []*pb.PriceLevel {
+	var result []*pb.PriceLevel
+	for price, size := range current {
+		if oldSize, exists := old[price]; !exists || oldSize != size {
+			result = append(result, &pb.PriceLevel{Price: price, Size: size})
+		}
+	}
+	for price := range old {
+		if _, exists := current[price]; !exists {
+			result = append(result, &pb.PriceLevel{Price: price, Size: 0})
+		}
+	}
+	sortLevels(result, descending)
+	return result
+}
+
+func sortLevels(result []*pb.PriceLevel, descending bool) {
+	sort.Slice(result, func(i, j int) bool {
+		if descending {
+			return result[i].Price > result[j].Price
+		}
+		return result[i].Price < result[j].Price
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	pb "ft-mt/proto"
+)
+
+// applyUpdate применяет обновление к локальной копии стакана, как это делает клиент
+func applyUpdate(side map[float64]float64, levels []*pb.PriceLevel) {
+	for _, level := range levels {
+		if level.Size == 0 {
+			delete(side, level.Price)
+		} else {
+			side[level.Price] = level.Size
+		}
+	}
+}
+
+// TestOrderBookSnapshot проверяет первый снимок стакана
+func TestOrderBookSnapshot(t *testing.T) {
+	book := NewOrderBook("SBER", 5, rand.New(rand.NewSource(1)))
+	update := book.Update(&pb.Quote{Symbol: "SBER", Price: 275.50, Bid: 275.43, Ask: 275.57, BidSize: 10, AskSize: 20})
+
+	if !update.Snapshot || update.Sequence != 1 {
+		t.Fatalf("Первое сообщение должно быть снимком с sequence=1, получено %v", update)
+	}
+	if len(update.Bids) != 5 || len(update.Asks) != 5 {
+		t.Fatalf("Ожидалось по 5 уровней, получено %d/%d", len(update.Bids), len(update.Asks))
+	}
+	if update.Bids[0].Price > 275.43 || update.Asks[0].Price < 275.57 {
+		t.Errorf("Лучшие уровни вне спреда: bid %.2f, ask %.2f", update.Bids[0].Price, update.Asks[0].Price)
+	}
+	if update.Bids[0].Size != 10 || update.Asks[0].Size != 20 {
+		t.Errorf("Объём лучших уровней должен совпадать с котировкой")
+	}
+	for i := 1; i < 5; i++ {
+		if update.Bids[i].Price >= update.Bids[i-1].Price {
+			t.Errorf("Bids должны идти по убыванию цены")
+		}
+		if update.Asks[i].Price <= update.Asks[i-1].Price {
+			t.Errorf("Asks должны идти по возрастанию цены")
+		}
+	}
+}
+
+// TestOrderBookIncremental проверяет, что инкременты восстанавливают стакан
+func TestOrderBookIncremental(t *testing.T) {
+	book := NewOrderBook("BTC", 10, rand.New(rand.NewSource(2)))
+	snapshot := book.Update(&pb.Quote{Price: 95400, Bid: 95390, Ask: 95410, BidSize: 5, AskSize: 5})
+
+	bids, asks := make(map[float64]float64), make(map[float64]float64)
+	applyUpdate(bids, snapshot.Bids)
+	applyUpdate(asks, snapshot.Asks)
+
+	prices := []float64{95401, 95402, 95401, 95400}
+	for i, price := range prices {
+		update := book.Update(&pb.Quote{Price: price, Bid: price - 10, Ask: price + 10, BidSize: 3, AskSize: 4})
+		if update.Snapshot || update.Sequence != uint64(i+2) {
+			t.Fatalf("Ожидалось инкрементальное обновление с sequence=%d, получено %v", i+2, update)
+		}
+		if len(update.Bids) >= 10 {
+			t.Errorf("При небольшом движении цены обновление должно быть меньше снимка")
+		}
+		applyUpdate(bids, update.Bids)
+		applyUpdate(asks, update.Asks)
+	}
+
+	if len(bids) != 10 || len(asks) != 10 {
+		t.Fatalf("После инкрементов ожидалось по 10 уровней, получено %d/%d", len(bids), len(asks))
+	}
+	for price, size := range book.bids {
+		if bids[price] != size {
+			t.Errorf("Bid %.0f: у клиента %.0f, на сервере %.0f", price, bids[price], size)
+		}
+	}
+	for price, size := range book.asks {
+		if asks[price] != size {
+			t.Errorf("Ask %.0f: у клиента %.0f, на сервере %.0f", price, asks[price], size)
+		}
+	}
+}
+
+// TestTickSize проверяет шаг цены для разных порядков
+func TestTickSize(t *testing.T) {
+	tests := []struct {
+		price float64
+		tick  float64
+	}{
+		{95400, 1},
+		{2650.20, 0.1},
+		{275.50, 0.01},
+	}
+	for _, tt := range tests {
+		if got := tickSize(tt.price); got < tt.tick*0.999 || got > tt.tick*1.001 {
+			t.Errorf("tickSize(%.2f) = %v, ожидалось %v", tt.price, got, tt.tick)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package quotes
+
+// CandleSnapshotHeader ключ метаданных заголовка StreamCandles: сколько свечей
+// снимка (history + текущая) придёт до live-обновлений. По нему клиент,
+// которому нужен только снимок, не ждёт следующего тика.
+const CandleSnapshotHeader = "x-candle-snapshot"
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// errReplayFinished финальный статус стримов, когда запись без REPLAY_LOOP доиграна
+var errReplayFinished = status.Error(codes.OutOfRange, "replay finished")
+
+// ReplayConfig настройки воспроизведения записанных тиков
+type ReplayConfig struct {
+	Path           string
+	Speed          float64 // Множитель скорости; 0 - максимально быстро
+	From           int64   // Unix ms, 0 - с начала записи
+	To             int64   // Unix ms, 0 - до конца записи
+	Loop           bool
+	KeepTimestamps bool // true - отдавать записанные timestamp вместо текущего времени
+}
+
+// replayConfigFromEnv читает REPLAY_* переменные; ok = false, если REPLAY_FILE не задан
+func replayConfigFromEnv() (cfg ReplayConfig, ok bool, err error) {
+	cfg.Path = getEnv("REPLAY_FILE", "")
+	if cfg.Path == "" {
+		return cfg, false, nil
+	}
+
+	switch speed := getEnv("REPLAY_SPEED", "1"); speed {
+	case "max":
+		cfg.Speed = 0
+	default:
+		cfg.Speed, err = strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+		if err != nil || cfg.Speed <= 0 {
+			return cfg, true, fmt.Errorf("некорректный REPLAY_SPEED %q (ожидается 1, 10x или max)", speed)
+		}
+	}
+
+	if cfg.From, err = parseReplayTime(getEnv("REPLAY_FROM", "")); err != nil {
+		return cfg, true, fmt.Errorf("некорректный REPLAY_FROM: %w", err)
+	}
+	if cfg.To, err = parseReplayTime(getEnv("REPLAY_TO", "")); err != nil {
+		return cfg, true, fmt.Errorf("некорректный REPLAY_TO: %w", err)
+	}
+	cfg.Loop = getEnv("REPLAY_LOOP", "false") == "true"
+	cfg.KeepTimestamps = getEnv("REPLAY_KEEP_TIMESTAMPS", "false") == "true"
+	return cfg, true, nil
+}
+
+// parseReplayTime принимает Unix ms или RFC3339
+func parseReplayTime(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return ms, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixMilli(), nil
+}
+
+// LoadReplayFile читает тики из CSV (по расширению .csv) или из файла
+// length-delimited protobuf Quote (формат FileTickStore) и сортирует по времени.
+// Недостающие bid/ask строятся от цены со спредом инструмента по умолчанию.
+func LoadReplayFile(path string) ([]*pb.Quote, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var quotes []*pb.Quote
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		quotes, err = readCSVQuotes(file)
+	} else {
+		quotes, err = readQuotes(context.Background(), bufio.NewReader(file),
+			func(*pb.Quote) (bool, bool) { return true, true }, math.MaxInt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	sort.SliceStable(quotes, func(i, j int) bool { return quotes[i].Timestamp < quotes[j].Timestamp })
+	for _, q := range quotes {
+		fillReplaySpread(q)
+	}
+	return quotes, nil
+}
+
+// replaySpreadBps спред символа из defaultInstruments, для остальных - defaultSpreadBps
+func replaySpreadBps(symbol string) float64 {
+	for _, inst := range defaultInstruments() {
+		if inst.Symbol == symbol {
+			return inst.SpreadBps
+		}
+	}
+	return defaultSpreadBps
+}
+
+// fillReplaySpread заполняет отсутствующие bid/ask, как их выставляет Engine:
+// иначе тики записи отличались бы от живых, а стакан строился бы вокруг 0
+func fillReplaySpread(q *pb.Quote) {
+	halfSpread := q.Price * replaySpreadBps(q.Symbol) / 10000 / 2
+	if q.Bid == 0 {
+		q.Bid = q.Price - halfSpread
+	}
+	if q.Ask == 0 {
+		q.Ask = q.Price + halfSpread
+	}
+}
+
+// readCSVQuotes читает CSV с заголовком. Обязательные колонки: symbol,
+// timestamp (Unix ms), price; необязательные: bid, ask, bid_size, ask_size,
+// last_size, volume.
+func readCSVQuotes(r io.Reader) ([]*pb.Quote, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("чтение заголовка CSV: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"symbol", "timestamp", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("в CSV нет колонки %q", required)
+		}
+	}
+
+	var quotes []*pb.Quote
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return quotes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		number := func(name string) (float64, error) {
+			i, ok := columns[name]
+			if !ok || record[i] == "" {
+				return 0, nil
+			}
+			return strconv.ParseFloat(record[i], 64)
+		}
+		q := &pb.Quote{Symbol: record[columns["symbol"]]}
+		if q.Timestamp, err = strconv.ParseInt(record[columns["timestamp"]], 10, 64); err != nil {
+			return nil, fmt.Errorf("строка %d: timestamp: %w", line, err)
+		}
+		fields := map[string]*float64{
+			"price": &q.Price, "bid": &q.Bid, "ask": &q.Ask, "bid_size": &q.BidSize,
+			"ask_size": &q.AskSize, "last_size": &q.LastSize, "volume": &q.Volume,
+		}
+		for name, field := range fields {
+			if *field, err = number(name); err != nil {
+				return nil, fmt.Errorf("строка %d: %s: %w", line, name, err)
+			}
+		}
+		quotes = append(quotes, q)
+	}
+}
+
+// replayInstruments инструменты записи: начальная цена и спред - по первому тику символа
+func replayInstruments(quotes []*pb.Quote) []Instrument {
+	seen := make(map[string]bool)
+	var instruments []Instrument
+	for _, q := range quotes {
+		if seen[q.Symbol] {
+			continue
+		}
+		seen[q.Symbol] = true
+		instruments = append(instruments, Instrument{
+			Symbol:       q.Symbol,
+			Name:         q.Symbol,
+			InitialPrice: q.Price,
+			SpreadBps:    replayTickSpreadBps(q),
+			IsActive:     true,
+		})
+	}
+	return instruments
+}
+
+// replayTickSpreadBps спред тика в базисных пунктах; без bid/ask - спред по умолчанию
+func replayTickSpreadBps(q *pb.Quote) float64 {
+	if q.Price <= 0 || q.Ask <= q.Bid {
+		return replaySpreadBps(q.Symbol)
+	}
+	return (q.Ask - q.Bid) / q.Price * 10000
+}
+
+// Replayer публикует записанные тики в Hub вместо генератора цен
+type Replayer struct {
+	cfg    ReplayConfig
+	quotes []*pb.Quote
+	clock  Clock
+	hub    *Hub
+
+	// shift сдвиг записанных timestamp (KeepTimestamps) на текущем круге:
+	// каждый круг продолжает время предыдущего, а не повторяет его
+	shift int64
+}
+
+// NewReplayer создаёт проигрыватель для тиков в диапазоне cfg.From..cfg.To
+func NewReplayer(cfg ReplayConfig, quotes []*pb.Quote, clock Clock, hub *Hub) (*Replayer, error) {
+	var selected []*pb.Quote
+	for _, q := range quotes {
+		if (cfg.From == 0 || q.Timestamp >= cfg.From) && (cfg.To == 0 || q.Timestamp <= cfg.To) {
+			selected = append(selected, q)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("в заданном диапазоне нет тиков")
+	}
+	return &Replayer{cfg: cfg, quotes: selected, clock: clock, hub: hub}, nil
+}
+
+// Instruments возвращает инструменты, встречающиеся в записи
+func (r *Replayer) Instruments() []Instrument {
+	return replayInstruments(r.quotes)
+}
+
+// Run ждёт первого подписчика и проигрывает запись (по кругу, если Loop) до
+// отмены контекста. Без Loop по окончании хаб закрывается: стримы завершаются
+// со статусом OUT_OF_RANGE, а не висят без котировок.
+func (r *Replayer) Run(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-r.hub.Active():
+	}
+	slog.Info("▶️ Подключился первый подписчик, начинаем воспроизведение", "path", r.cfg.Path)
+
+	for pass := 1; ; pass++ {
+		if !r.play(ctx) {
+			return
+		}
+		if !r.cfg.Loop {
+			slog.Info("⏹️ Воспроизведение завершено, стримы закрываются", "path", r.cfg.Path)
+			r.hub.Close()
+			return
+		}
+		r.shift += r.loopDuration()
+		slog.Info("🔁 Круг воспроизведения завершён", "path", r.cfg.Path, "pass", pass)
+	}
+}
+
+// loopDuration на сколько сдвигается время записи за круг, в ms: длина записи
+// плюс средний интервал между тиками, чтобы первый тик нового круга шёл после
+// последнего. Иначе агрегатор свечей отбросил бы тики с прошедшим временем.
+func (r *Replayer) loopDuration() int64 {
+	span := r.quotes[len(r.quotes)-1].Timestamp - r.quotes[0].Timestamp
+	step := int64(1)
+	if n := int64(len(r.quotes)); n > 1 && span >= n-1 {
+		step = span / (n - 1)
+	}
+	return span + step
+}
+
+// play проигрывает запись один раз, сохраняя интервалы между тиками с учётом
+// скорости; возвращает false, если контекст отменён. На максимальной скорости
+// публикация ждёт самого медленного подписчика, а не выбрасывает тики.
+func (r *Replayer) play(ctx context.Context) bool {
+	start := r.clock.Now()
+	first := r.quotes[0].Timestamp
+
+	for _, recorded := range r.quotes {
+		if r.cfg.Speed > 0 {
+			delta := time.Duration(recorded.Timestamp-first) * time.Millisecond
+			offset := time.Duration(float64(delta) / r.cfg.Speed)
+			if wait := start.Add(offset).Sub(r.clock.Now()); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return false
+				case <-r.clock.After(wait):
+				}
+			}
+		} else if ctx.Err() != nil {
+			return false
+		}
+
+		quote := proto.Clone(recorded).(*pb.Quote)
+		if r.cfg.KeepTimestamps {
+			quote.Timestamp += r.shift
+		} else {
+			quote.Timestamp = r.clock.Now().UnixMilli()
+		}
+		ticksGenerated.WithLabelValues(quote.Symbol).Inc()
+		if r.cfg.Speed > 0 {
+			r.hub.Publish(quote)
+		} else if !r.hub.PublishWait(ctx, quote) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+)
+
+// TestLoadReplayCSV проверяет разбор CSV и сортировку по времени
+func TestLoadReplayCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticks.csv")
+	data := "symbol,timestamp,price,bid,ask\n" +
+		"BTC,2000,101.5,101,102\n" +
+		"ETH,1000,50,,\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	quotes, err := LoadReplayFile(path)
+	if err != nil {
+		t.Fatalf("LoadReplayFile() вернул ошибку: %v", err)
+	}
+	if len(quotes) != 2 || quotes[0].Symbol != "ETH" || quotes[1].Symbol != "BTC" {
+		t.Fatalf("Ожидались ETH, BTC по времени, получено %v", quotes)
+	}
+	if q := quotes[1]; q.Price != 101.5 || q.Bid != 101 || q.Ask != 102 || q.Timestamp != 2000 {
+		t.Errorf("Неверно разобрана строка BTC: %v", q)
+	}
+	// Без bid/ask - спред ETH по умолчанию (3 bps) вокруг цены
+	if q := quotes[0]; math.Abs(q.Bid-49.9925) > 1e-9 || math.Abs(q.Ask-50.0075) > 1e-9 {
+		t.Errorf("Ожидались bid/ask со спредом 3 bps, получено %v", q)
+	}
+	instruments := replayInstruments(quotes)
+	if instruments[0].SpreadBps < 2.99 || instruments[0].SpreadBps > 3.01 {
+		t.Errorf("Ожидался спред ETH 3 bps, получено %v", instruments[0].SpreadBps)
+	}
+	if spread := instruments[1].SpreadBps; math.Abs(spread-1/101.5*10000) > 1e-9 {
+		t.Errorf("Спред BTC должен браться из записи, получено %v", spread)
+	}
+	if spread := replaySpreadBps("AAPL"); spread != defaultSpreadBps {
+		t.Errorf("Неизвестный символ: ожидался спред %v, получено %v", float64(defaultSpreadBps), spread)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.csv")
+	if err := os.WriteFile(bad, []byte("symbol,price\nBTC,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReplayFile(bad); err == nil {
+		t.Error("CSV без колонки timestamp должен отклоняться")
+	}
+}
+
+// TestLoadReplayTickFile проверяет чтение файла, записанного FileTickStore
+func TestLoadReplayTickFile(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileTickStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := []*pb.Quote{
+		{Symbol: "BTC", Price: 1, Timestamp: 1000},
+		{Symbol: "BTC", Price: 2, Timestamp: 2000},
+	}
+	if err := store.Write(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	quotes, err := LoadReplayFile(filepath.Join(dir, "BTC.ticks"))
+	if err != nil {
+		t.Fatalf("LoadReplayFile() вернул ошибку: %v", err)
+	}
+	if len(quotes) != 2 || quotes[1].Price != 2 {
+		t.Errorf("Ожидались 2 тика BTC, получено %v", quotes)
+	}
+}
+
+// TestReplayerSpeed проверяет, что интервалы между тиками делятся на скорость
+func TestReplayerSpeed(t *testing.T) {
+	clock := newFakeClock()
+	hub := NewHub(16, PolicyDropOldest)
+	quotes := []*pb.Quote{
+		{Symbol: "BTC", Price: 1, Timestamp: 10_000},
+		{Symbol: "BTC", Price: 2, Timestamp: 11_000},
+		{Symbol: "BTC", Price: 3, Timestamp: 13_000},
+	}
+	replayer, err := NewReplayer(ReplayConfig{Speed: 2}, quotes, clock, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := hub.Subscribe(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replayer.Run(ctx)
+
+	start := clock.Now()
+	expectQuote := func(price float64, at time.Time) {
+		t.Helper()
+		select {
+		case q := <-sub.C:
+			if q.Price != price || q.Timestamp != at.UnixMilli() {
+				t.Errorf("Ожидалась цена %.0f в %d, получено %.0f в %d", price, at.UnixMilli(), q.Price, q.Timestamp)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Не дождались тика с ценой %.0f", price)
+		}
+	}
+
+	expectQuote(1, start)
+	clock.WaitForTickers(t, 1)
+	clock.Advance(500 * time.Millisecond)
+	expectQuote(2, start.Add(500*time.Millisecond))
+	clock.WaitForTickers(t, 2)
+	clock.Advance(time.Second)
+	expectQuote(3, start.Add(1500*time.Millisecond))
+}
+
+// TestReplayerRangeAndLoop проверяет фильтр по времени, повтор и исходные
+// timestamp: следующий круг продолжает время записи, а не повторяет его
+func TestReplayerRangeAndLoop(t *testing.T) {
+	hub := NewHub(16, PolicyDropOldest)
+	quotes := []*pb.Quote{
+		{Symbol: "BTC", Price: 1, Timestamp: 1000},
+		{Symbol: "BTC", Price: 2, Timestamp: 2000},
+		{Symbol: "ETH", Price: 3, Timestamp: 3000},
+		{Symbol: "BTC", Price: 4, Timestamp: 4000},
+	}
+	clock := newFakeClock()
+	cfg := ReplayConfig{Speed: 1, From: 2000, To: 3000, Loop: true, KeepTimestamps: true}
+	replayer, err := NewReplayer(cfg, quotes, clock, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instruments := replayer.Instruments(); len(instruments) != 2 || instruments[0].InitialPrice != 2 {
+		t.Errorf("Ожидались инструменты BTC (2) и ETH, получено %v", instruments)
+	}
+	sub := hub.Subscribe(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		replayer.Run(ctx)
+		close(done)
+	}()
+
+	// Круг - 1000ms записи плюс средний интервал 1000ms
+	wantTimestamps := []int64{2000, 3000, 4000, 5000}
+	for i, want := range []float64{2, 3, 2, 3} {
+		if i%2 == 1 {
+			clock.WaitForTickers(t, i/2+1)
+			clock.Advance(time.Second)
+		}
+		q := <-sub.C
+		if q.Price != want {
+			t.Errorf("Тик %d: ожидалась цена %.0f, получено %.0f", i, want, q.Price)
+		}
+		if q.Timestamp != wantTimestamps[i] {
+			t.Errorf("Тик %d: ожидался timestamp %d, получено %d", i, wantTimestamps[i], q.Timestamp)
+		}
+	}
+	cancel()
+	<-done
+
+	if _, err := NewReplayer(ReplayConfig{From: 5000}, quotes, newFakeClock(), hub); err == nil {
+		t.Error("Пустой диапазон должен отклоняться")
+	}
+}
+
+// TestReplayerWaitsForSubscriber проверяет, что воспроизведение начинается с
+// первым подписчиком, а не при старте FT
+func TestReplayerWaitsForSubscriber(t *testing.T) {
+	hub := NewHub(16, PolicyDropOldest)
+	quotes := []*pb.Quote{{Symbol: "BTC", Price: 1, Timestamp: 1000}, {Symbol: "BTC", Price: 2, Timestamp: 2000}}
+	replayer, err := NewReplayer(ReplayConfig{Speed: 1}, quotes, newFakeClock(), hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replayer.Run(ctx)
+
+	// Внутренний потребитель (агрегатор свечей) не запускает воспроизведение
+	internal := hub.SubscribeInternal()
+	time.Sleep(20 * time.Millisecond)
+	if len(internal.C) != 0 {
+		t.Fatal("До первого подписчика тики не должны публиковаться")
+	}
+
+	sub := hub.Subscribe(nil)
+	select {
+	case q := <-sub.C:
+		if q.Price != 1 {
+			t.Errorf("Первый подписчик должен получить запись с начала, получено %.0f", q.Price)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Не дождались первого тика")
+	}
+}
+
+// TestReplayerMaxSpeed проверяет, что на максимальной скорости тики не
+// теряются при маленьком буфере, а по окончании стрим закрывается
+func TestReplayerMaxSpeed(t *testing.T) {
+	hub := NewHub(2, PolicyDisconnect)
+	var quotes []*pb.Quote
+	for i := 1; i <= 20; i++ {
+		quotes = append(quotes, &pb.Quote{Symbol: "BTC", Price: float64(i), Timestamp: int64(i)})
+	}
+	replayer, err := NewReplayer(ReplayConfig{Speed: 0}, quotes, newFakeClock(), hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := hub.Subscribe(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replayer.Run(ctx)
+
+	var prices []float64
+	for q := range sub.C {
+		prices = append(prices, q.Price)
+		time.Sleep(time.Millisecond) // Медленный клиент
+	}
+	if len(prices) != len(quotes) || prices[len(prices)-1] != 20 {
+		t.Errorf("Ожидались все %d тиков, получено %v", len(quotes), prices)
+	}
+	if sub.Slow() || !sub.Finished() {
+		t.Errorf("Стрим должен завершиться концом записи, а не отключением: slow=%v finished=%v", sub.Slow(), sub.Finished())
+	}
+}
+
+// TestReplayerSubMillisecondSpeed проверяет, что задержка при дробной
+// скорости не округляется до целых миллисекунд
+func TestReplayerSubMillisecondSpeed(t *testing.T) {
+	clock := newFakeClock()
+	hub := NewHub(16, PolicyDropOldest)
+	quotes := []*pb.Quote{{Symbol: "BTC", Price: 1, Timestamp: 0}, {Symbol: "BTC", Price: 2, Timestamp: 1000}}
+	replayer, err := NewReplayer(ReplayConfig{Speed: 3}, quotes, clock, hub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := hub.Subscribe(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replayer.Run(ctx)
+
+	<-sub.C
+	clock.WaitForTickers(t, 1)
+	// 1000ms / 3 = 333.33ms: через 333ms второй тик ещё не должен прийти
+	clock.Advance(333 * time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if len(sub.C) != 0 {
+		t.Fatal("Задержка округлена до 333ms")
+	}
+	clock.Advance(time.Millisecond)
+	select {
+	case q := <-sub.C:
+		if q.Price != 2 {
+			t.Errorf("Ожидалась цена 2, получено %.0f", q.Price)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Не дождались второго тика")
+	}
+}
@@ -11,6 +11,7 @@ CREATE TABLE IF NOT EXISTS users (
   is_active BOOLEAN DEFAULT true,
   created_at TIMESTAMP DEFAULT NOW(),
   last_login TIMESTAMP,
+  token_version INTEGER NOT NULL DEFAULT 0, -- Увеличивается при выходе на всех устройствах
   CONSTRAINT email_format CHECK (email ~* '^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$')
 );
 
@@ -25,6 +26,9 @@ CREATE TABLE IF NOT EXISTS instruments (
   name VARCHAR(100) NOT NULL,
   initial_price DECIMAL(18, 8) NOT NULL CHECK (initial_price > 0),
   volatility DECIMAL(5, 2) DEFAULT 0.1 CHECK (volatility >= 0 AND volatility <= 100),
+  spread_bps DECIMAL(8, 2) DEFAULT 5 CHECK (spread_bps >= 0),
+  model VARCHAR(20) DEFAULT 'uniform' CHECK (model IN ('uniform', 'gbm', 'ou', 'merton')),
+  model_params JSONB DEFAULT '{}',
   is_active BOOLEAN DEFAULT true,
   created_at TIMESTAMP DEFAULT NOW(),
   updated_at TIMESTAMP DEFAULT NOW(),
@@ -35,19 +39,76 @@ CREATE TABLE IF NOT EXISTS instruments (
 CREATE INDEX idx_instruments_symbol ON instruments(symbol);
 CREATE INDEX idx_instruments_is_active ON instruments(is_active);
 
--- Таблица refresh токенов (для Auth Service)
+-- Таблица refresh токенов (для Auth Service). Хранится только SHA-256 токена;
+-- токены, выданные обменом друг за другом, образуют семейство (family_id)
 CREATE TABLE IF NOT EXISTS refresh_tokens (
   id SERIAL PRIMARY KEY,
   user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
   token VARCHAR(255) UNIQUE NOT NULL,
+  family_id VARCHAR(64) NOT NULL,
   expires_at TIMESTAMP NOT NULL,
   created_at TIMESTAMP DEFAULT NOW(),
+  used_at TIMESTAMP,     -- Токен обменян на новый; повторный обмен отзывает семейство
+  revoked_at TIMESTAMP,
   CONSTRAINT future_expiration CHECK (expires_at > created_at)
 );
 
 -- Индекс для быстрой проверки токенов
 CREATE INDEX idx_refresh_tokens_token ON refresh_tokens(token);
 CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- Отозванные при выходе access токены (для Auth Service, REVOCATION_STORE=postgres).
+-- Запись нужна только до истечения токена, потом удаляется
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti VARCHAR(64) PRIMARY KEY,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+-- Одноразовые токены сброса пароля (для Auth Service), хранится только SHA-256
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token VARCHAR(255) UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,   -- Использован или заменён более новым запросом сброса
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+-- Одноразовые коды приглашения (для Auth Service, REGISTRATION_POLICY=invite), хранится только SHA-256
+CREATE TABLE IF NOT EXISTS invite_codes (
+  id SERIAL PRIMARY KEY,
+  code VARCHAR(255) UNIQUE NOT NULL,
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Таблица истории тиков (для FT, TICK_STORE=postgres)
+CREATE TABLE IF NOT EXISTS ticks (
+  id BIGSERIAL PRIMARY KEY,
+  symbol VARCHAR(10) NOT NULL,
+  ts BIGINT NOT NULL,
+  price DOUBLE PRECISION NOT NULL,
+  bid DOUBLE PRECISION,
+  ask DOUBLE PRECISION,
+  bid_size DOUBLE PRECISION,
+  ask_size DOUBLE PRECISION,
+  last_size DOUBLE PRECISION,
+  volume DOUBLE PRECISION
+);
+
+-- Индекс для постраничной выборки истории по символу и курсору (ts, id)
+CREATE INDEX idx_ticks_symbol_ts_id ON ticks(symbol, ts, id);
+-- Индекс для удаления тиков старше TICK_RETENTION
+CREATE INDEX idx_ticks_ts ON ticks(ts);
 
 -- Таблица истории изменений инструментов (audit log)
 CREATE TABLE IF NOT EXISTS instruments_audit (
@@ -63,6 +124,21 @@ CREATE TABLE IF NOT EXISTS instruments_audit (
 CREATE INDEX idx_instruments_audit_instrument_id ON instruments_audit(instrument_id);
 CREATE INDEX idx_instruments_audit_created_at ON instruments_audit(created_at);
 
+-- Действия администраторов над пользователями (audit log). user_id без внешнего
+-- ключа: запись остаётся и после удаления пользователя
+CREATE TABLE IF NOT EXISTS user_audit (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  action VARCHAR(50) NOT NULL CHECK (action IN ('created', 'role_changed', 'activated', 'deactivated', 'deleted', 'invite_created')),
+  changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  old_data JSONB,
+  new_data JSONB,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_audit_user_id ON user_audit(user_id);
+CREATE INDEX idx_user_audit_created_at ON user_audit(created_at);
+
 -- ============================================
 -- Начальные данные
 -- ============================================
@@ -77,12 +153,12 @@ INSERT INTO users (email, password_hash, role) VALUES
 ON CONFLICT (email) DO NOTHING;
 
 -- Добавляем начальные инструменты
-INSERT INTO instruments (symbol, name, initial_price, volatility, created_by) VALUES
-  ('BTC', 'Bitcoin', 95400.00, 0.5, 1),
-  ('ETH', 'Ethereum', 2650.20, 0.3, 1),
-  ('SBER', 'Сбербанк', 275.50, 0.1, 1),
-  ('AAPL', 'Apple Inc.', 185.50, 0.2, 1),
-  ('GOOGL', 'Google', 142.30, 0.2, 1)
+INSERT INTO instruments (symbol, name, initial_price, volatility, spread_bps, model, model_params, created_by) VALUES
+  ('BTC', 'Bitcoin', 95400.00, 0.5, 2, 'merton', '{"drift": 0.1, "sigma": 0.6, "lambda": 20, "jump_std": 0.03}', 1),
+  ('ETH', 'Ethereum', 2650.20, 0.3, 3, 'gbm', '{"drift": 0.05, "sigma": 0.7}', 1),
+  ('SBER', 'Сбербанк', 275.50, 0.1, 5, 'ou', '{"theta": 50, "mean": 275.50, "sigma": 60}', 1),
+  ('AAPL', 'Apple Inc.', 185.50, 0.2, 1, 'uniform', '{}', 1),
+  ('GOOGL', 'Google', 142.30, 0.2, 1, 'uniform', '{}', 1)
 ON CONFLICT (symbol) DO NOTHING;
 
 -- ============================================
@@ -183,9 +259,14 @@ COMMENT ON TABLE users IS 'Пользователи системы';
 COMMENT ON TABLE instruments IS 'Торговые инструменты (акции, криптовалюты)';
 COMMENT ON TABLE refresh_tokens IS 'Refresh токены для JWT авторизации';
 COMMENT ON TABLE instruments_audit IS 'История изменений инструментов';
+COMMENT ON TABLE ticks IS 'История тиков, сгенерированных FT';
 
 COMMENT ON COLUMN users.role IS 'Роль: admin (полный доступ), trader (торговля), user (просмотр), viewer (только чтение)';
 COMMENT ON COLUMN instruments.volatility IS 'Волатильность в процентах (например, 0.1 = ±0.1% изменение)';
+COMMENT ON COLUMN instruments.spread_bps IS 'Спред bid/ask в FT в базисных пунктах (5 = 0.05% от цены)';
+COMMENT ON COLUMN instruments.model IS 'Модель цены в FT: uniform (±volatility%), gbm, ou (возврат к среднему), merton (скачки)';
+COMMENT ON COLUMN ticks.ts IS 'Время тика, Unix timestamp в миллисекундах';
+COMMENT ON COLUMN instruments.model_params IS 'Параметры модели в годовом исчислении, например {"drift": 0.05, "sigma": 0.3}';
 
 -- ============================================
 -- Готово!
@@ -0,0 +1,106 @@
+-- ============================================
+-- Quotopia Database Migrations
+-- ============================================
+-- init.sql выполняется только при создании тома postgres_data. Этот файл
+-- доводит существующую БД до текущей схемы и безопасен при повторном запуске:
+-- docker-compose выполняет его сервисом migrate при каждом старте.
+
+-- Модели цены в FT (колонки instruments.model/model_params)
+ALTER TABLE instruments
+  ADD COLUMN IF NOT EXISTS model VARCHAR(20) DEFAULT 'uniform' CHECK (model IN ('uniform', 'gbm', 'ou', 'merton'));
+ALTER TABLE instruments
+  ADD COLUMN IF NOT EXISTS model_params JSONB DEFAULT '{}';
+
+COMMENT ON COLUMN instruments.model IS 'Модель цены в FT: uniform (±volatility%), gbm, ou (возврат к среднему), merton (скачки)';
+COMMENT ON COLUMN instruments.model_params IS 'Параметры модели в годовом исчислении, например {"drift": 0.05, "sigma": 0.3}';
+
+-- Спред bid/ask в FT
+ALTER TABLE instruments
+  ADD COLUMN IF NOT EXISTS spread_bps DECIMAL(8, 2) DEFAULT 5 CHECK (spread_bps >= 0);
+
+COMMENT ON COLUMN instruments.spread_bps IS 'Спред bid/ask в FT в базисных пунктах (5 = 0.05% от цены)';
+
+-- История тиков FT (TICK_STORE=postgres): курсор страниц (ts, id) и удаление по TICK_RETENTION
+CREATE TABLE IF NOT EXISTS ticks (
+  id BIGSERIAL PRIMARY KEY,
+  symbol VARCHAR(10) NOT NULL,
+  ts BIGINT NOT NULL,
+  price DOUBLE PRECISION NOT NULL,
+  bid DOUBLE PRECISION,
+  ask DOUBLE PRECISION,
+  bid_size DOUBLE PRECISION,
+  ask_size DOUBLE PRECISION,
+  last_size DOUBLE PRECISION,
+  volume DOUBLE PRECISION
+);
+
+CREATE INDEX IF NOT EXISTS idx_ticks_symbol_ts_id ON ticks(symbol, ts, id);
+CREATE INDEX IF NOT EXISTS idx_ticks_ts ON ticks(ts);
+DROP INDEX IF EXISTS idx_ticks_symbol_ts;
+
+COMMENT ON TABLE ticks IS 'История тиков, сгенерированных FT';
+COMMENT ON COLUMN ticks.ts IS 'Время тика, Unix timestamp в миллисекундах';
+
+-- Refresh токены: семейство (family_id) для обнаружения повторного обмена.
+-- Токены старой схемы хранились без хеширования и больше не принимаются:
+-- каждый получает собственное семейство, чтобы колонка стала NOT NULL
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS used_at TIMESTAMP;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP;
+UPDATE refresh_tokens SET family_id = 'legacy-' || id WHERE family_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN family_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- Выход на всех устройствах (users.token_version) и отозванные при выходе access токены
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti VARCHAR(64) PRIMARY KEY,
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+-- Одноразовые токены сброса пароля
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  token VARCHAR(255) UNIQUE NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+
+-- Действия администраторов над пользователями и выдача приглашений (audit log)
+CREATE TABLE IF NOT EXISTS user_audit (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  action VARCHAR(50) NOT NULL CHECK (action IN ('created', 'role_changed', 'activated', 'deactivated', 'deleted', 'invite_created')),
+  changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  old_data JSONB,
+  new_data JSONB,
+  created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_audit_user_id ON user_audit(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_audit_created_at ON user_audit(created_at);
+
+-- Список действий пополняется: CHECK пересоздаётся с актуальным списком
+ALTER TABLE user_audit DROP CONSTRAINT IF EXISTS user_audit_action_check;
+ALTER TABLE user_audit ADD CONSTRAINT user_audit_action_check
+  CHECK (action IN ('created', 'role_changed', 'activated', 'deactivated', 'deleted', 'invite_created'));
+
+-- Одноразовые коды приглашения (REGISTRATION_POLICY=invite), хранится только SHA-256
+CREATE TABLE IF NOT EXISTS invite_codes (
+  id SERIAL PRIMARY KEY,
+  code VARCHAR(255) UNIQUE NOT NULL,
+  created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
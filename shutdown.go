@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errShuttingDown финальный статус активных стримов при остановке FT
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down")
+
+// Shutdown переводит сервер в режим остановки: активные стримы завершаются
+// со статусом UNAVAILABLE, по которому клиенты переподключаются
+func (s *QuoteServer) Shutdown() {
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
+}
+
+// gracefulStop перестаёт принимать подключения и ждёт завершения текущих
+// вызовов не дольше timeout, после чего закрывает оставшиеся принудительно
+func gracefulStop(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		slog.Warn("⚠️ Не все вызовы завершились, закрываем принудительно", "timeout", timeout.String())
+		server.Stop()
+		<-stopped
+	}
+}
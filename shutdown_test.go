@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestShutdownEndsStreams проверяет, что при остановке активные стримы
+// завершаются со статусом UNAVAILABLE
+func TestShutdownEndsStreams(t *testing.T) {
+	server := newTestQuoteServer(newFakeClock())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 3)
+	go func() { errs <- server.StreamQuotes(&pb.QuoteRequest{}, newFakeQuoteStream(ctx)) }()
+	go func() {
+		errs <- server.StreamQuotes(&pb.QuoteRequest{IntervalMs: 1000, Mode: pb.DeliveryMode_CONFLATED}, newFakeQuoteStream(ctx))
+	}()
+	go func() { errs <- server.Subscribe(newFakeSubscribeStream(ctx)) }()
+	for server.hub.Len() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	server.Shutdown()
+	server.Shutdown() // Повторный вызов безопасен
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-errs:
+			if status.Code(err) != codes.Unavailable {
+				t.Errorf("Ожидался UNAVAILABLE, получено %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Стрим не завершился после Shutdown")
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sort"
+
+	"ft-mt/internal/logging"
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Subscribe реализует двунаправленную подписку. Клиент начинает с пустым
+// набором и меняет его сообщениями SUBSCRIBE/UNSUBSCRIBE; на каждое сообщение
+// приходит ack с итоговым набором или error, если сообщение не применено.
+// Сообщение с неизвестными тикерами отклоняется целиком.
+func (s *QuoteServer) Subscribe(stream pb.QuoteService_SubscribeServer) error {
+	logger := logging.FromContext(stream.Context())
+	logger.Info("Новая динамическая подписка")
+
+	sub := s.hub.SubscribeSymbols(nil)
+	defer s.hub.Unsubscribe(sub)
+
+	requests := make(chan *pb.SubscribeRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	symbols := make(map[string]bool)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.shutdown:
+			return errShuttingDown
+		case err := <-recvErr:
+			// Клиент закрыл свою сторону - подписка завершена
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case req := <-requests:
+			if err := stream.Send(s.applySubscribe(logger, sub, symbols, req)); err != nil {
+				logger.Warn("Ошибка отправки ответа подписки", "error", err)
+				return err
+			}
+		case quote, ok := <-sub.C:
+			if !ok {
+				if sub.Slow() {
+					return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+				}
+				if sub.Finished() {
+					return errReplayFinished
+				}
+				return status.Error(codes.Unavailable, "quote stream closed")
+			}
+			// Котировки отписанных тикеров могли остаться в буфере
+			if !symbols[quote.Symbol] {
+				continue
+			}
+			if err := stream.Send(&pb.SubscribeResponse{Payload: &pb.SubscribeResponse_Quote{Quote: quote}}); err != nil {
+				logger.Warn("Ошибка отправки", "error", err)
+				return err
+			}
+		}
+	}
+}
+
+// applySubscribe применяет управляющее сообщение к набору symbols и возвращает ack или error
+func (s *QuoteServer) applySubscribe(logger *slog.Logger, sub *Subscriber, symbols map[string]bool, req *pb.SubscribeRequest) *pb.SubscribeResponse {
+	reject := func(code codes.Code, message string, unknown []string) *pb.SubscribeResponse {
+		return &pb.SubscribeResponse{Payload: &pb.SubscribeResponse_Error{Error: &pb.SubscribeError{
+			Id:      req.Id,
+			Code:    code.String(),
+			Message: message,
+			Symbols: unknown,
+		}}}
+	}
+
+	if len(req.Symbols) == 0 {
+		return reject(codes.InvalidArgument, "symbols is required", nil)
+	}
+
+	switch req.Action {
+	case pb.SubscribeAction_SUBSCRIBE:
+		var unknown []string
+		for _, symbol := range req.Symbols {
+			if _, ok := s.engine.Instrument(symbol); !ok {
+				unknown = append(unknown, symbol)
+			}
+		}
+		if len(unknown) > 0 {
+			return reject(codes.InvalidArgument, "unknown symbols", unknown)
+		}
+		for _, symbol := range req.Symbols {
+			symbols[symbol] = true
+		}
+	case pb.SubscribeAction_UNSUBSCRIBE:
+		for _, symbol := range req.Symbols {
+			delete(symbols, symbol)
+		}
+	default:
+		return reject(codes.InvalidArgument, "action must be SUBSCRIBE or UNSUBSCRIBE", nil)
+	}
+
+	current := make([]string, 0, len(symbols))
+	for symbol := range symbols {
+		current = append(current, symbol)
+	}
+	sort.Strings(current)
+	s.hub.SetSymbols(sub, current)
+	logger.Info("Подписка изменена", "action", req.Action.String(), "symbols", req.Symbols, "current", current)
+
+	return &pb.SubscribeResponse{Payload: &pb.SubscribeResponse_Ack{Ack: &pb.SubscribeAck{
+		Id:      req.Id,
+		Action:  req.Action,
+		Symbols: current,
+	}}}
+}
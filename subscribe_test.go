@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc"
+)
+
+// fakeSubscribeStream двунаправленный стрим подписки для тестов
+type fakeSubscribeStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv chan *pb.SubscribeRequest
+	sent chan *pb.SubscribeResponse
+}
+
+func newFakeSubscribeStream(ctx context.Context) *fakeSubscribeStream {
+	return &fakeSubscribeStream{
+		ctx:  ctx,
+		recv: make(chan *pb.SubscribeRequest),
+		sent: make(chan *pb.SubscribeResponse, 100),
+	}
+}
+
+func (f *fakeSubscribeStream) Context() context.Context { return f.ctx }
+
+func (f *fakeSubscribeStream) Recv() (*pb.SubscribeRequest, error) {
+	req, ok := <-f.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (f *fakeSubscribeStream) Send(resp *pb.SubscribeResponse) error {
+	f.sent <- resp
+	return nil
+}
+
+// next ждёт следующее сообщение сервера
+func (f *fakeSubscribeStream) next(t *testing.T) *pb.SubscribeResponse {
+	t.Helper()
+	select {
+	case resp := <-f.sent:
+		return resp
+	case <-time.After(2 * time.Second):
+		t.Fatal("Не дождались ответа сервера")
+		return nil
+	}
+}
+
+// TestSubscribe проверяет подтверждения, ошибки и смену набора тикеров
+func TestSubscribe(t *testing.T) {
+	clock := newFakeClock()
+	server := newTestQuoteServer(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go server.engine.Run(ctx)
+	clock.WaitForTickers(t, 1)
+
+	stream := newFakeSubscribeStream(ctx)
+	done := make(chan error, 1)
+	go func() { done <- server.Subscribe(stream) }()
+
+	stream.recv <- &pb.SubscribeRequest{Id: "1", Action: pb.SubscribeAction_SUBSCRIBE, Symbols: []string{"BTC"}}
+	if ack := stream.next(t).GetAck(); ack == nil || ack.Id != "1" || len(ack.Symbols) != 1 || ack.Symbols[0] != "BTC" {
+		t.Fatalf("Ожидался ack 1 с набором [BTC], получено %v", ack)
+	}
+
+	stream.recv <- &pb.SubscribeRequest{Id: "2", Action: pb.SubscribeAction_SUBSCRIBE, Symbols: []string{"ETH", "DOGE"}}
+	if e := stream.next(t).GetError(); e == nil || e.Id != "2" || e.Code != "InvalidArgument" ||
+		len(e.Symbols) != 1 || e.Symbols[0] != "DOGE" {
+		t.Fatalf("Ожидалась ошибка 2 с тикером DOGE, получено %v", e)
+	}
+
+	clock.Advance(time.Second)
+	if quote := stream.next(t).GetQuote(); quote == nil || quote.Symbol != "BTC" {
+		t.Fatalf("Ожидалась котировка BTC, получено %v", quote)
+	}
+
+	stream.recv <- &pb.SubscribeRequest{Id: "3", Action: pb.SubscribeAction_UNSUBSCRIBE, Symbols: []string{"BTC"}}
+	if ack := stream.next(t).GetAck(); ack == nil || len(ack.Symbols) != 0 {
+		t.Fatalf("Ожидался ack 3 с пустым набором, получено %v", ack)
+	}
+	stream.recv <- &pb.SubscribeRequest{Id: "4", Action: pb.SubscribeAction_SUBSCRIBE, Symbols: []string{"ETH"}}
+	if ack := stream.next(t).GetAck(); ack == nil || ack.Id != "4" {
+		t.Fatalf("Ожидался ack 4, получено %v", ack)
+	}
+
+	clock.Advance(time.Second)
+	if quote := stream.next(t).GetQuote(); quote == nil || quote.Symbol != "ETH" {
+		t.Fatalf("Ожидалась котировка ETH, получено %v", quote)
+	}
+
+	stream.recv <- &pb.SubscribeRequest{Id: "5", Symbols: []string{"ETH"}}
+	if e := stream.next(t).GetError(); e == nil || e.Id != "5" {
+		t.Fatalf("Для сообщения без action ожидалась ошибка, получено %v", e)
+	}
+
+	close(stream.recv)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("После закрытия клиентом ожидалось nil, получено %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe не завершился после закрытия клиентом")
+	}
+	if server.hub.Len() != 0 {
+		t.Error("Подписчик должен быть удалён из хаба")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ListSymbols возвращает активные инструменты с их параметрами
+func (s *QuoteServer) ListSymbols(ctx context.Context, req *pb.ListSymbolsRequest) (*pb.ListSymbolsResponse, error) {
+	instruments := s.engine.Instruments()
+	resp := &pb.ListSymbolsResponse{Symbols: make([]*pb.SymbolInfo, 0, len(instruments))}
+	for _, inst := range instruments {
+		resp.Symbols = append(resp.Symbols, &pb.SymbolInfo{
+			Symbol:       inst.Symbol,
+			Name:         inst.Name,
+			InitialPrice: inst.InitialPrice,
+			Volatility:   inst.Volatility,
+			SpreadBps:    inst.SpreadBps,
+			Model:        inst.Model,
+		})
+	}
+	return resp, nil
+}
+
+// validateSymbol проверяет поле symbol запроса
+func (s *QuoteServer) validateSymbol(symbol string) error {
+	if _, ok := s.engine.Instrument(symbol); ok {
+		return nil
+	}
+	return unknownSymbolsError([]string{"symbol"}, []string{strconv.Quote(symbol)})
+}
+
+// validateSymbols проверяет поле symbols запроса; пустой список - все инструменты
+func (s *QuoteServer) validateSymbols(symbols []string) error {
+	var fields, unknown []string
+	for i, symbol := range symbols {
+		if _, ok := s.engine.Instrument(symbol); !ok {
+			fields = append(fields, fmt.Sprintf("symbols[%d]", i))
+			unknown = append(unknown, strconv.Quote(symbol))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return unknownSymbolsError(fields, unknown)
+}
+
+// unknownSymbolsError INVALID_ARGUMENT с errdetails.BadRequest: по нарушению
+// на каждый неизвестный тикер, field - путь к нему в запросе
+func unknownSymbolsError(fields, symbols []string) error {
+	badRequest := &errdetails.BadRequest{}
+	for i, field := range fields {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: "unknown symbol " + symbols[i],
+		})
+	}
+
+	st := status.Newf(codes.InvalidArgument, "unknown symbol %s", strings.Join(symbols, ", "))
+	if detailed, err := st.WithDetails(badRequest); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestStreamQuotesUnknownSymbols проверяет, что неизвестные тикеры отклоняются
+// с BadRequest в details, а не пропускаются молча
+func TestStreamQuotesUnknownSymbols(t *testing.T) {
+	server := newTestQuoteServer(newFakeClock())
+	stream := newFakeQuoteStream(context.Background())
+
+	err := server.StreamQuotes(&pb.QuoteRequest{Symbols: []string{"BTC", "DOGE", "ETH", "XRP"}}, stream)
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Ожидался InvalidArgument, получено %v", err)
+	}
+	if server.hub.Len() != 0 {
+		t.Error("При ошибке валидации подписка не должна создаваться")
+	}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			violations = badRequest.FieldViolations
+		}
+	}
+	if len(violations) != 2 {
+		t.Fatalf("Ожидались 2 нарушения в BadRequest, получено %v", st.Details())
+	}
+	if violations[0].Field != "symbols[1]" || violations[1].Field != "symbols[3]" {
+		t.Errorf("Ожидались поля symbols[1] и symbols[3], получено %v", violations)
+	}
+}
+
+// TestListSymbols проверяет список инструментов с параметрами
+func TestListSymbols(t *testing.T) {
+	server := newTestQuoteServer(newFakeClock())
+
+	resp, err := server.ListSymbols(context.Background(), &pb.ListSymbolsRequest{})
+	if err != nil {
+		t.Fatalf("ListSymbols() вернул ошибку: %v", err)
+	}
+	if len(resp.Symbols) != 3 || resp.Symbols[0].Symbol != "BTC" || resp.Symbols[2].Symbol != "SBER" {
+		t.Fatalf("Ожидались BTC, ETH, SBER по алфавиту, получено %v", resp.Symbols)
+	}
+	if btc := resp.Symbols[0]; btc.InitialPrice != 95400 || btc.SpreadBps != 2 || btc.Model != ModelUniform {
+		t.Errorf("Неверные параметры BTC: %v", btc)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"github.com/lib/pq"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// TickStore хранилище истории тиков
+type TickStore interface {
+	// Write сохраняет пачку тиков
+	Write(ctx context.Context, quotes []*pb.Quote) error
+	// Query возвращает до limit тиков символа после позиции after и с timestamp <= to
+	// (Unix ms) по возрастанию (timestamp, id)
+	Query(ctx context.Context, symbol string, after TickCursor, to int64, limit int) ([]StoredTick, error)
+	Close() error
+}
+
+// TickPruner хранилище, которое умеет удалять старые тики (TICK_RETENTION)
+type TickPruner interface {
+	// Prune удаляет тики с timestamp < before (Unix ms) и возвращает их число
+	Prune(ctx context.Context, before int64) (int64, error)
+}
+
+// TickCursor позиция тика в хранилище. id различает тики с одинаковым
+// timestamp: в postgres это ticks.id, в файле - номер записи с 1.
+// Курсор {from, 0} указывает на начало миллисекунды from.
+type TickCursor struct {
+	Timestamp int64
+	ID        int64
+}
+
+// After сообщает, идёт ли позиция (timestamp, id) после курсора
+func (c TickCursor) After(timestamp, id int64) bool {
+	return timestamp > c.Timestamp || timestamp == c.Timestamp && id > c.ID
+}
+
+// String кодирует курсор для next_cursor: "<timestamp>.<id>"
+func (c TickCursor) String() string {
+	return strconv.FormatInt(c.Timestamp, 10) + "." + strconv.FormatInt(c.ID, 10)
+}
+
+// ParseTickCursor разбирает курсор, закодированный TickCursor.String
+func ParseTickCursor(value string) (TickCursor, error) {
+	ts, id, ok := strings.Cut(value, ".")
+	if ok {
+		timestamp, tsErr := strconv.ParseInt(ts, 10, 64)
+		position, idErr := strconv.ParseInt(id, 10, 64)
+		if tsErr == nil && idErr == nil && position >= 0 {
+			return TickCursor{Timestamp: timestamp, ID: position}, nil
+		}
+	}
+	return TickCursor{}, fmt.Errorf("некорректный курсор %q", value)
+}
+
+// StoredTick тик с его позицией в хранилище
+type StoredTick struct {
+	Quote  *pb.Quote
+	Cursor TickCursor
+}
+
+// PostgresTickStore хранит тики в таблице ticks
+type PostgresTickStore struct {
+	db *sql.DB
+}
+
+// NewPostgresTickStore создаёт хранилище тиков поверх пула БД
+func NewPostgresTickStore(db *sql.DB) *PostgresTickStore {
+	return &PostgresTickStore{db: db}
+}
+
+// Write сохраняет пачку тиков одной командой COPY
+func (p *PostgresTickStore) Write(ctx context.Context, quotes []*pb.Quote) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("ticks",
+		"symbol", "ts", "price", "bid", "ask", "bid_size", "ask_size", "last_size", "volume"))
+	if err != nil {
+		return err
+	}
+	for _, q := range quotes {
+		if _, err := stmt.ExecContext(ctx, q.Symbol, q.Timestamp, q.Price, q.Bid, q.Ask,
+			q.BidSize, q.AskSize, q.LastSize, q.Volume); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Query реализует TickStore
+func (p *PostgresTickStore) Query(ctx context.Context, symbol string, after TickCursor, to int64, limit int) ([]StoredTick, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT id, symbol, ts, price, bid, ask, bid_size, ask_size, last_size, volume
+		FROM ticks
+		WHERE symbol = $1 AND (ts, id) > ($2, $3) AND ts <= $4
+		ORDER BY ts, id
+		LIMIT $5
+	`, symbol, after.Timestamp, after.ID, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ticks []StoredTick
+	for rows.Next() {
+		var id int64
+		q := &pb.Quote{}
+		if err := rows.Scan(&id, &q.Symbol, &q.Timestamp, &q.Price, &q.Bid, &q.Ask,
+			&q.BidSize, &q.AskSize, &q.LastSize, &q.Volume); err != nil {
+			return nil, err
+		}
+		ticks = append(ticks, StoredTick{Quote: q, Cursor: TickCursor{Timestamp: q.Timestamp, ID: id}})
+	}
+	return ticks, rows.Err()
+}
+
+// Prune реализует TickPruner
+func (p *PostgresTickStore) Prune(ctx context.Context, before int64) (int64, error) {
+	result, err := p.db.ExecContext(ctx, "DELETE FROM ticks WHERE ts < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Close реализует TickStore; пулом БД владеет main
+func (p *PostgresTickStore) Close() error {
+	return nil
+}
+
+// FileTickStore встроенное хранилище для локальных запусков: по файлу
+// <SYMBOL>.ticks на символ с length-delimited protobuf сообщениями Quote
+type FileTickStore struct {
+	mu    sync.Mutex
+	dir   string
+	files map[string]*os.File
+}
+
+// NewFileTickStore создаёт хранилище в каталоге dir
+func NewFileTickStore(dir string) (*FileTickStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileTickStore{dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+// Write дописывает тики в файлы символов
+func (f *FileTickStore) Write(ctx context.Context, quotes []*pb.Quote) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	writers := make(map[string]*bufio.Writer)
+	for _, q := range quotes {
+		w, ok := writers[q.Symbol]
+		if !ok {
+			file, err := f.fileLocked(q.Symbol)
+			if err != nil {
+				return err
+			}
+			w = bufio.NewWriter(file)
+			writers[q.Symbol] = w
+		}
+		if _, err := protodelim.MarshalTo(w, q); err != nil {
+			return err
+		}
+	}
+	for _, w := range writers {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FileTickStore) fileLocked(symbol string) (*os.File, error) {
+	if file, ok := f.files[symbol]; ok {
+		return file, nil
+	}
+	path, err := f.path(symbol)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	f.files[symbol] = file
+	return file, nil
+}
+
+// path возвращает путь к файлу символа, не выпуская его за пределы каталога
+func (f *FileTickStore) path(symbol string) (string, error) {
+	invalid := symbol == "" || symbol[0] == '.'
+	for _, r := range symbol {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			invalid = true
+		}
+	}
+	if invalid {
+		return "", fmt.Errorf("недопустимый символ для имени файла: %q", symbol)
+	}
+	return filepath.Join(f.dir, symbol+".ticks"), nil
+}
+
+// Query последовательно читает файл символа; id тика - номер записи в файле
+func (f *FileTickStore) Query(ctx context.Context, symbol string, after TickCursor, to int64, limit int) ([]StoredTick, error) {
+	path, err := f.path(symbol)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var (
+		record int64
+		ids    []int64
+	)
+	quotes, err := readQuotes(ctx, bufio.NewReader(file), func(q *pb.Quote) (bool, bool) {
+		record++
+		if q.Timestamp > to {
+			return false, false
+		}
+		keep := after.After(q.Timestamp, record)
+		if keep {
+			ids = append(ids, record)
+		}
+		return keep, true
+	}, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ticks := make([]StoredTick, len(quotes))
+	for i, q := range quotes {
+		ticks[i] = StoredTick{Quote: q, Cursor: TickCursor{Timestamp: q.Timestamp, ID: ids[i]}}
+	}
+	return ticks, nil
+}
+
+// readQuotes читает length-delimited котировки, пока filter разрешает продолжать
+func readQuotes(ctx context.Context, r *bufio.Reader, filter func(*pb.Quote) (keep, more bool), limit int) ([]*pb.Quote, error) {
+	var quotes []*pb.Quote
+	for len(quotes) < limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		q := &pb.Quote{}
+		if err := protodelim.UnmarshalFrom(r, q); err != nil {
+			// Недописанная последняя запись считается концом файла
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, err
+		}
+		keep, more := filter(q)
+		if keep {
+			quotes = append(quotes, q)
+		}
+		if !more {
+			break
+		}
+	}
+	return quotes, nil
+}
+
+// Close закрывает файлы символов
+func (f *FileTickStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+	for symbol, file := range f.files {
+		errs = append(errs, file.Close())
+		delete(f.files, symbol)
+	}
+	return errors.Join(errs...)
+}
+
+// TickRecorder асинхронно пишет тики из хаба в хранилище пачками
+type TickRecorder struct {
+	store         TickStore
+	batchSize     int
+	flushInterval time.Duration
+	batches       chan []*pb.Quote
+}
+
+// NewTickRecorder создаёт писателя; queue - сколько пачек может ждать записи
+func NewTickRecorder(store TickStore, batchSize int, flushInterval time.Duration, queue int) *TickRecorder {
+	return &TickRecorder{
+		store:         store,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		batches:       make(chan []*pb.Quote, queue),
+	}
+}
+
+// Run читает тики из хаба до отмены контекста. Пачка уходит в запись при
+// достижении batchSize или по таймеру; запись идёт в отдельной горутине,
+// поэтому медленное хранилище не тормозит чтение из хаба. Подписка
+// внутренняя: политика медленных подписчиков не останавливает запись.
+func (r *TickRecorder) Run(ctx context.Context, hub *Hub) {
+	sub := hub.SubscribeInternal()
+	defer hub.Unsubscribe(sub)
+
+	done := make(chan struct{})
+	go r.writeLoop(done)
+	defer func() {
+		close(r.batches)
+		<-done
+	}()
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*pb.Quote, 0, r.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		select {
+		case r.batches <- batch:
+		default:
+			slog.Warn("⚠️ Очередь записи тиков переполнена, тики пропущены", "dropped", len(batch))
+		}
+		batch = make([]*pb.Quote, 0, r.batchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Дописываем тики, которые уже лежат в буфере подписки
+			for drained := false; !drained; {
+				select {
+				case quote, ok := <-sub.C:
+					if ok {
+						batch = append(batch, quote)
+					}
+					drained = !ok
+				default:
+					drained = true
+				}
+			}
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		case quote, ok := <-sub.C:
+			if !ok {
+				flush()
+				slog.Warn("⚠️ Запись тиков отключена от хаба")
+				return
+			}
+			batch = append(batch, quote)
+			if len(batch) >= r.batchSize {
+				flush()
+			}
+		}
+	}
+}
+
+// writeLoop пишет пачки в хранилище, пока канал не закрыт
+func (r *TickRecorder) writeLoop(done chan<- struct{}) {
+	defer close(done)
+
+	for batch := range r.batches {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := r.store.Write(ctx, batch); err != nil {
+			slog.Error("⚠️ Не удалось сохранить тики", "count", len(batch), "error", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	pb "ft-mt/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memoryTickStore хранилище в памяти для тестов записи
+type memoryTickStore struct {
+	mu      sync.Mutex
+	batches [][]*pb.Quote
+}
+
+func (m *memoryTickStore) Write(ctx context.Context, quotes []*pb.Quote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, quotes)
+	return nil
+}
+
+func (m *memoryTickStore) Query(ctx context.Context, symbol string, after TickCursor, to int64, limit int) ([]StoredTick, error) {
+	return nil, nil
+}
+
+func (m *memoryTickStore) Close() error { return nil }
+
+func (m *memoryTickStore) count() (batches, ticks int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, batch := range m.batches {
+		ticks += len(batch)
+	}
+	return len(m.batches), ticks
+}
+
+// TestFileTickStore проверяет запись и выборку по диапазону времени
+func TestFileTickStore(t *testing.T) {
+	store, err := NewFileTickStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	for i := int64(1); i <= 5; i++ {
+		batch := []*pb.Quote{
+			{Symbol: "BTC", Price: float64(i), Timestamp: i * 1000},
+			{Symbol: "ETH", Price: float64(i * 10), Timestamp: i * 1000},
+		}
+		if err := store.Write(ctx, batch); err != nil {
+			t.Fatalf("Write() вернул ошибку: %v", err)
+		}
+	}
+
+	ticks, err := store.Query(ctx, "BTC", TickCursor{Timestamp: 2000}, 4000, 10)
+	if err != nil {
+		t.Fatalf("Query() вернул ошибку: %v", err)
+	}
+	if len(ticks) != 3 || ticks[0].Quote.Price != 2 || ticks[2].Quote.Price != 4 {
+		t.Errorf("Ожидались тики BTC 2..4, получено %v", ticks)
+	}
+	if ticks[0].Cursor != (TickCursor{Timestamp: 2000, ID: 2}) {
+		t.Errorf("Курсор тика должен содержать номер записи, получено %+v", ticks[0].Cursor)
+	}
+
+	limited, _ := store.Query(ctx, "ETH", TickCursor{}, 10000, 2)
+	if len(limited) != 2 || limited[1].Quote.Price != 20 {
+		t.Errorf("Ожидались первые 2 тика ETH, получено %v", limited)
+	}
+	if next, _ := store.Query(ctx, "ETH", limited[1].Cursor, 10000, 1); len(next) != 1 || next[0].Quote.Price != 30 {
+		t.Errorf("После курсора ожидался тик ETH 30, получено %v", next)
+	}
+	if empty, err := store.Query(ctx, "SBER", TickCursor{}, 10000, 10); err != nil || len(empty) != 0 {
+		t.Errorf("Для символа без истории ожидался пустой ответ, получено %v, %v", empty, err)
+	}
+	if _, err := store.Query(ctx, "../etc/passwd", TickCursor{}, 1, 1); err == nil {
+		t.Error("Символ с путём должен отклоняться")
+	}
+}
+
+// TestTickRecorderBatches проверяет запись пачками и сброс остатка при остановке
+func TestTickRecorderBatches(t *testing.T) {
+	hub := NewHub(100, PolicyDropOldest)
+	store := &memoryTickStore{}
+	recorder := NewTickRecorder(store, 3, time.Hour, 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		recorder.Run(ctx, hub)
+		close(done)
+	}()
+	for hub.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 7; i++ {
+		hub.Publish(&pb.Quote{Symbol: "BTC", Timestamp: int64(i)})
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for batches, _ := store.count(); batches < 2 && time.Now().Before(deadline); batches, _ = store.count() {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	batches, ticks := store.count()
+	if batches != 3 || ticks != 7 {
+		t.Errorf("Ожидалось 3 пачки и 7 тиков, получено %d и %d", batches, ticks)
+	}
+}
+
+// TestGetHistoryPagination проверяет постраничную выдачу истории: тики одной
+// миллисекунды на границе страниц не теряются
+func TestGetHistoryPagination(t *testing.T) {
+	store, err := NewFileTickStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var quotes []*pb.Quote
+	for i := int64(1); i <= 5; i++ {
+		// Тики 2 и 3 в одной миллисекунде
+		ts := i
+		if i == 3 {
+			ts = 2
+		}
+		quotes = append(quotes, &pb.Quote{Symbol: "BTC", Price: float64(i), Timestamp: ts})
+	}
+	store.Write(context.Background(), quotes)
+
+	server := NewQuoteServer()
+	server.ticks = store
+
+	page, err := server.GetHistory(context.Background(), &pb.HistoryRequest{Symbol: "BTC", Limit: 2})
+	if err != nil {
+		t.Fatalf("GetHistory() вернул ошибку: %v", err)
+	}
+	if len(page.Quotes) != 2 || !page.HasMore {
+		t.Fatalf("Ожидалась страница из 2 тиков с has_more, получено %v", page)
+	}
+
+	page, _ = server.GetHistory(context.Background(), &pb.HistoryRequest{Symbol: "BTC", Cursor: page.NextCursor, Limit: 3})
+	if len(page.Quotes) != 3 || page.HasMore || page.Quotes[0].Price != 3 || page.NextCursor != "" {
+		t.Errorf("Ожидалась последняя страница из 3 тиков с тиком 3, получено %v", page)
+	}
+}
+
+// TestTickCursor проверяет кодирование курсора истории
+func TestTickCursor(t *testing.T) {
+	cursor := TickCursor{Timestamp: 1704988123456, ID: 42}
+	parsed, err := ParseTickCursor(cursor.String())
+	if err != nil || parsed != cursor {
+		t.Errorf("Ожидался %+v, получено %+v, %v", cursor, parsed, err)
+	}
+	for _, value := range []string{"", "123", "a.1", "1.b", "1.-1"} {
+		if _, err := ParseTickCursor(value); err == nil {
+			t.Errorf("Курсор %q должен отклоняться", value)
+		}
+	}
+	if !cursor.After(cursor.Timestamp, 43) || cursor.After(cursor.Timestamp, 42) || !cursor.After(cursor.Timestamp+1, 1) {
+		t.Error("After должен сравнивать (timestamp, id)")
+	}
+}
+
+// fakeTickPruner запоминает границы удаления
+type fakeTickPruner struct {
+	before chan int64
+}
+
+func (f *fakeTickPruner) Prune(ctx context.Context, before int64) (int64, error) {
+	f.before <- before
+	return 1, nil
+}
+
+// TestRunTickPruner проверяет удаление тиков старше retention при старте и по таймеру
+func TestRunTickPruner(t *testing.T) {
+	clock := newFakeClock()
+	pruner := &fakeTickPruner{before: make(chan int64, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go runTickPruner(ctx, pruner, time.Hour, time.Minute, clock)
+
+	if before := <-pruner.before; before != clock.Now().Add(-time.Hour).UnixMilli() {
+		t.Errorf("При старте ожидалась граница now-1h, получено %d", before)
+	}
+	clock.WaitForTickers(t, 1)
+	go clock.Advance(time.Minute)
+	if before := <-pruner.before; before != clock.Now().Add(-time.Hour).UnixMilli() {
+		t.Errorf("По таймеру ожидалась граница now-1h, получено %d", before)
+	}
+}
+
+// TestGetHistoryErrors проверяет коды ошибок GetHistory
+func TestGetHistoryErrors(t *testing.T) {
+	server := NewQuoteServer()
+	if _, err := server.GetHistory(context.Background(), &pb.HistoryRequest{Symbol: "BTC"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Без хранилища ожидался FailedPrecondition, получено %v", err)
+	}
+
+	server.ticks = &memoryTickStore{}
+	requests := []*pb.HistoryRequest{
+		{},
+		{Symbol: "BTC", Limit: maxHistoryLimit + 1},
+		{Symbol: "BTC", From: 10, To: 5},
+		{Symbol: "BTC", Cursor: "garbage"},
+	}
+	for _, req := range requests {
+		if _, err := server.GetHistory(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%v: ожидался InvalidArgument, получено %v", req, err)
+		}
+	}
+}
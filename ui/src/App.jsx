@@ -3,24 +3,30 @@ import { useState, useEffect } from 'react'
 function App() {
   const [quotes, setQuotes] = useState([])
   const [loading, setLoading] = useState(false)
+  const [stale, setStale] = useState(false)
 
   useEffect(() => {
-    const fetchQuotes = async () => {
-      try {
-        setLoading(true)
-        const res = await fetch('/quotes')
-        const data = await res.json()
-        setQuotes(data)
-      } catch (error) {
-        console.error('Error:', error)
-      } finally {
-        setLoading(false)
-      }
+    // Первое событие каждого символа - снимок из кеша HT, дальше живые котировки.
+    // При обрыве EventSource переподключается сам и присылает Last-Event-ID.
+    setLoading(true)
+    const source = new EventSource('/quotes/stream')
+
+    source.addEventListener('quote', (event) => {
+      const quote = JSON.parse(event.data)
+      setQuotes((prev) => {
+        const next = prev.filter((q) => q.symbol !== quote.symbol)
+        next.push(quote)
+        return next.sort((a, b) => a.symbol.localeCompare(b.symbol))
+      })
+      setStale(false)
+      setLoading(false)
+    })
+    source.onerror = () => {
+      setStale(true)
+      setLoading(false)
     }
 
-    fetchQuotes()
-    const interval = setInterval(fetchQuotes, 2000)
-    return () => clearInterval(interval)
+    return () => source.close()
   }, [])
 
   return (
@@ -37,6 +43,12 @@ function App() {
           </div>
         )}
 
+        {stale && quotes.length > 0 && (
+          <div className="mb-8 p-4 rounded-xl border border-yellow-600 bg-yellow-900/30 text-yellow-300 text-center">
+            ⚠️ Нет связи с генератором котировок, цены могут быть устаревшими
+          </div>
+        )}
+
         <div className="bg-gray-900/50 backdrop-blur-xl rounded-2xl p-8 shadow-2xl border border-gray-700">
           <table className="w-full">
             <thead>
@@ -75,7 +87,7 @@ function App() {
 
         <div className="mt-12 text-center text-sm text-gray-500 space-y-2">
           <p>DevOps Sandbox • gRPC + REST + React + Docker</p>
-          <p>Обновление каждые 2 сек • TailwindCSS • Vite</p>
+          <p>Live обновления через SSE • TailwindCSS • Vite</p>
         </div>
       </div>
     </div>